@@ -14,8 +14,8 @@ var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run the server",
 	Long:  `Run the server and start listening for requests`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		config := config.New(cmd.Context())
-		server.Run(config)
+		return server.Run(config)
 	},
 }
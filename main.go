@@ -1,7 +1,13 @@
 package main
 
-import "github.com/nais/bifrost/cmd"
+import (
+	"os"
+
+	"github.com/nais/bifrost/cmd"
+)
 
 func main() {
-	_ = cmd.Execute()
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
 }
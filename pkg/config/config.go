@@ -4,12 +4,16 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
 	"github.com/sethvargo/go-envconfig"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 type MetaConfig struct {
@@ -54,7 +58,17 @@ type ServerConfig struct {
 	ReadTimeout     int    `env:"BIFROST_READ_TIMEOUT,default=15"`
 	IdleTimeout     int    `env:"BIFROST_IDLE_TIMEOUT,default=60"`
 	GracefulTimeout int    `env:"BIFROST_GRACEFUL_TIMEOUT,default=15"`
+	RequestTimeout  int    `env:"BIFROST_REQUEST_TIMEOUT,default=0"`
 	TemplatesDir    string `env:"BIFROST_TEMPLATE_DIR,default=./templates"`
+	GzipEnabled     bool   `env:"BIFROST_GZIP_ENABLED,default=true"`
+	GzipMinSize     int    `env:"BIFROST_GZIP_MIN_SIZE,default=1024"`
+	StrictJSON      bool   `env:"BIFROST_STRICT_JSON,default=false"`
+	RateLimits      string `env:"BIFROST_RATE_LIMITS"`
+}
+
+type TracingConfig struct {
+	Enabled      bool   `env:"BIFROST_TRACING_ENABLED,default=false"`
+	OTLPEndpoint string `env:"BIFROST_TRACING_OTLP_ENDPOINT,default=http://localhost:4318"`
 }
 
 type GoogleConfig struct {
@@ -69,23 +83,114 @@ type TeamsConfig struct {
 }
 
 type UnleashConfig struct {
-	InstanceNamespace       string `env:"BIFROST_UNLEASH_INSTANCE_NAMESPACE,required"`
-	InstanceServiceaccount  string `env:"BIFROST_UNLEASH_INSTANCE_SERVICEACCOUNT,required"`
-	SQLInstanceID           string `env:"BIFROST_UNLEASH_SQL_INSTANCE_ID,required"`
-	SQLInstanceRegion       string `env:"BIFROST_UNLEASH_SQL_INSTANCE_REGION,required"`
-	SQLInstanceAddress      string `env:"BIFROST_UNLEASH_SQL_INSTANCE_ADDRESS,required"`
-	InstanceWebIngressHost  string `env:"BIFROST_UNLEASH_INSTANCE_WEB_INGRESS_HOST,required"`
-	InstanceWebIngressClass string `env:"BIFROST_UNLEASH_INSTANCE_WEB_INGRESS_CLASS,required"`
-	InstanceAPIIngressHost  string `env:"BIFROST_UNLEASH_INSTANCE_API_INGRESS_HOST,required"`
-	InstanceAPIIngressClass string `env:"BIFROST_UNLEASH_INSTANCE_API_INGRESS_CLASS,required"`
-	TeamsApiURL             string `env:"BIFROST_UNLEASH_INSTANCE_TEAMS_API_URL,required"`
-	TeamsApiSecretName      string `env:"BIFROST_UNLEASH_INSTANCE_TEAMS_API_SECRET_NAME,required"`
-	TeamsApiSecretTokenKey  string `env:"BIFROST_UNLEASH_INSTANCE_TEAMS_API_TOKEN_SECRET_KEY,required"`
+	InstanceNamespace              string `env:"BIFROST_UNLEASH_INSTANCE_NAMESPACE,required"`
+	InstanceNamespaceCreate        bool   `env:"BIFROST_UNLEASH_INSTANCE_NAMESPACE_CREATE,default=false"`
+	InstanceServiceaccount         string `env:"BIFROST_UNLEASH_INSTANCE_SERVICEACCOUNT,required"`
+	SQLInstanceID                  string `env:"BIFROST_UNLEASH_SQL_INSTANCE_ID,required"`
+	SQLInstanceRegion              string `env:"BIFROST_UNLEASH_SQL_INSTANCE_REGION,required"`
+	SQLInstanceAddress             string `env:"BIFROST_UNLEASH_SQL_INSTANCE_ADDRESS,required"`
+	SQLInstances                   string `env:"BIFROST_UNLEASH_SQL_INSTANCES"`
+	InstanceWebIngressHost         string `env:"BIFROST_UNLEASH_INSTANCE_WEB_INGRESS_HOST,required"`
+	InstanceWebIngressClass        string `env:"BIFROST_UNLEASH_INSTANCE_WEB_INGRESS_CLASS,required"`
+	InstanceAPIIngressHost         string `env:"BIFROST_UNLEASH_INSTANCE_API_INGRESS_HOST,required"`
+	InstanceAPIIngressClass        string `env:"BIFROST_UNLEASH_INSTANCE_API_INGRESS_CLASS,required"`
+	TeamsApiURL                    string `env:"BIFROST_UNLEASH_INSTANCE_TEAMS_API_URL,required"`
+	TeamsApiSecretName             string `env:"BIFROST_UNLEASH_INSTANCE_TEAMS_API_SECRET_NAME,required"`
+	TeamsApiSecretTokenKey         string `env:"BIFROST_UNLEASH_INSTANCE_TEAMS_API_TOKEN_SECRET_KEY,required"`
+	TeamsApiSecretRequired         bool   `env:"BIFROST_UNLEASH_INSTANCE_TEAMS_API_SECRET_REQUIRED,default=false"`
+	FederationNonceMinLength       int    `env:"BIFROST_UNLEASH_FEDERATION_NONCE_MIN_LENGTH,default=8"`
+	Environment                    string `env:"BIFROST_UNLEASH_ENVIRONMENT"`
+	DedupCreates                   bool   `env:"BIFROST_UNLEASH_DEDUP_CREATES,default=true"`
+	SQLMaxConcurrentDeletes        int    `env:"BIFROST_UNLEASH_SQL_MAX_CONCURRENT_DELETES,default=2"`
+	DeleteDrainSeconds             int    `env:"BIFROST_UNLEASH_DELETE_DRAIN_SECONDS,default=5"`
+	SQLOperationMaxRetries         int    `env:"BIFROST_UNLEASH_SQL_OPERATION_MAX_RETRIES,default=3"`
+	ReaperEnabled                  bool   `env:"BIFROST_UNLEASH_REAPER_ENABLED,default=false"`
+	ReaperDryRun                   bool   `env:"BIFROST_UNLEASH_REAPER_DRY_RUN,default=true"`
+	ReaperIntervalMinutes          int    `env:"BIFROST_UNLEASH_REAPER_INTERVAL_MINUTES,default=60"`
+	AdmissionPolicyURL             string `env:"BIFROST_UNLEASH_ADMISSION_POLICY_URL"`
+	EventWebhookURL                string `env:"BIFROST_UNLEASH_EVENT_WEBHOOK_URL"`
+	EventQueueSize                 int    `env:"BIFROST_UNLEASH_EVENT_QUEUE_SIZE,default=100"`
+	ExtraEgressFQDNs               string `env:"BIFROST_UNLEASH_EXTRA_EGRESS_FQDNS"`
+	DefaultVersion                 string `env:"BIFROST_UNLEASH_DEFAULT_VERSION,default=v5.10.2-20240329-070801-0180a96"`
+	VerifyCustomVersion            bool   `env:"BIFROST_UNLEASH_VERIFY_CUSTOM_VERSION,default=false"`
+	CustomImageRepo                string `env:"BIFROST_UNLEASH_CUSTOM_IMAGE_REPO,default=europe-north1-docker.pkg.dev/nais-io/nais/images/"`
+	CustomImageName                string `env:"BIFROST_UNLEASH_CUSTOM_IMAGE_NAME,default=unleash-v4"`
+	SecretRepairEnabled            bool   `env:"BIFROST_UNLEASH_SECRET_REPAIR_ENABLED,default=false"`
+	BlockVersionChangeWhenNotReady bool   `env:"BIFROST_UNLEASH_BLOCK_VERSION_CHANGE_WHEN_NOT_READY,default=false"`
+	DatabasePoolIdleTimeoutMinMs   int    `env:"BIFROST_UNLEASH_DATABASE_POOL_IDLE_TIMEOUT_MIN_MS,default=100"`
+	DatabasePoolIdleTimeoutMaxMs   int    `env:"BIFROST_UNLEASH_DATABASE_POOL_IDLE_TIMEOUT_MAX_MS,default=60000"`
+	SqlProxyCPURequest             string `env:"BIFROST_UNLEASH_SQL_PROXY_CPU_REQUEST,default=10m"`
+	SqlProxyMemoryRequest          string `env:"BIFROST_UNLEASH_SQL_PROXY_MEMORY_REQUEST,default=100Mi"`
+	SqlProxyMemoryLimit            string `env:"BIFROST_UNLEASH_SQL_PROXY_MEMORY_LIMIT,default=100Mi"`
+}
+
+type RateLimit struct {
+	PerMinute int
+	Burst     int
+}
+
+// ParseRateLimits parses BIFROST_RATE_LIMITS, a comma separated list of method:per-minute:burst entries.
+func (s *ServerConfig) ParseRateLimits() (map[string]RateLimit, error) {
+	limits := map[string]RateLimit{}
+	for _, entry := range strings.Split(s.RateLimits, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid rate limit %q in BIFROST_RATE_LIMITS, expected method:per-minute:burst", entry)
+		}
+
+		perMinute, err := strconv.Atoi(parts[1])
+		if err != nil || perMinute < 1 {
+			return nil, fmt.Errorf("invalid requests per minute %q for %s in BIFROST_RATE_LIMITS", parts[1], parts[0])
+		}
+		burst, err := strconv.Atoi(parts[2])
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("invalid burst %q for %s in BIFROST_RATE_LIMITS", parts[2], parts[0])
+		}
+
+		limits[strings.ToUpper(parts[0])] = RateLimit{PerMinute: perMinute, Burst: burst}
+	}
+
+	return limits, nil
+}
+
+type SQLInstance struct {
+	ID      string
+	Region  string
+	Address string
+}
+
+// ParseSQLInstances parses BIFROST_UNLEASH_SQL_INSTANCES, a comma separated list of id:region:address entries.
+func (u *UnleashConfig) ParseSQLInstances() ([]SQLInstance, error) {
+	instances := []SQLInstance{}
+	for _, entry := range strings.Split(u.SQLInstances, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid SQL instance %q in BIFROST_UNLEASH_SQL_INSTANCES, expected id:region:address", entry)
+		}
+		if net.ParseIP(parts[2]) == nil {
+			return nil, fmt.Errorf("invalid address %q for SQL instance %s in BIFROST_UNLEASH_SQL_INSTANCES", parts[2], parts[0])
+		}
+
+		instances = append(instances, SQLInstance{ID: parts[0], Region: parts[1], Address: parts[2]})
+	}
+
+	return instances, nil
 }
 
 type Config struct {
 	Meta                MetaConfig
 	Server              ServerConfig
+	Tracing             TracingConfig
 	Google              GoogleConfig
 	Teams               TeamsConfig
 	Unleash             UnleashConfig
@@ -116,6 +221,52 @@ func (c *Config) GinMiddleware() gin.HandlerFunc {
 	}
 }
 
+func (c *Config) Validate() error {
+	quantities := map[string]string{
+		"BIFROST_UNLEASH_SQL_PROXY_CPU_REQUEST":    c.Unleash.SqlProxyCPURequest,
+		"BIFROST_UNLEASH_SQL_PROXY_MEMORY_REQUEST": c.Unleash.SqlProxyMemoryRequest,
+		"BIFROST_UNLEASH_SQL_PROXY_MEMORY_LIMIT":   c.Unleash.SqlProxyMemoryLimit,
+	}
+
+	if c.Unleash.ReaperEnabled && c.Unleash.ReaperIntervalMinutes < 1 {
+		return fmt.Errorf("BIFROST_UNLEASH_REAPER_INTERVAL_MINUTES must be at least 1 when the reaper is enabled")
+	}
+
+	if c.Unleash.DatabasePoolIdleTimeoutMinMs > c.Unleash.DatabasePoolIdleTimeoutMaxMs {
+		return fmt.Errorf("BIFROST_UNLEASH_DATABASE_POOL_IDLE_TIMEOUT_MIN_MS must not be greater than BIFROST_UNLEASH_DATABASE_POOL_IDLE_TIMEOUT_MAX_MS")
+	}
+
+	if _, err := c.Unleash.ParseSQLInstances(); err != nil {
+		return err
+	}
+
+	if _, err := c.Server.ParseRateLimits(); err != nil {
+		return err
+	}
+
+	validate := validator.New()
+	for _, fqdn := range strings.Split(c.Unleash.ExtraEgressFQDNs, ",") {
+		fqdn = strings.TrimSpace(fqdn)
+		if fqdn == "" {
+			continue
+		}
+		if err := validate.Var(fqdn, "fqdn"); err != nil {
+			return fmt.Errorf("invalid FQDN %q in BIFROST_UNLEASH_EXTRA_EGRESS_FQDNS", fqdn)
+		}
+	}
+
+	for name, value := range quantities {
+		if value == "" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(value); err != nil {
+			return fmt.Errorf("invalid resource quantity %q for %s: %w", value, name, err)
+		}
+	}
+
+	return nil
+}
+
 func Setup(com *cobra.Command) {
 	err := godotenv.Load()
 	if err != nil {
@@ -131,5 +282,9 @@ func New(ctx context.Context) *Config {
 		panic(err)
 	}
 
+	if err := c.Validate(); err != nil {
+		panic(err)
+	}
+
 	return &c
 }
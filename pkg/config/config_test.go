@@ -0,0 +1,84 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigValidate(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.Validate())
+
+	c.Unleash.SqlProxyCPURequest = "250m"
+	c.Unleash.SqlProxyMemoryRequest = "256Mi"
+	c.Unleash.SqlProxyMemoryLimit = "512Mi"
+	assert.NoError(t, c.Validate())
+
+	c.Unleash.SqlProxyMemoryLimit = "lots"
+	assert.ErrorContains(t, c.Validate(), `invalid resource quantity "lots" for BIFROST_UNLEASH_SQL_PROXY_MEMORY_LIMIT`)
+
+	c.Unleash.SqlProxyMemoryLimit = ""
+	c.Unleash.ReaperEnabled = true
+	assert.ErrorContains(t, c.Validate(), "BIFROST_UNLEASH_REAPER_INTERVAL_MINUTES must be at least 1")
+
+	c.Unleash.ReaperIntervalMinutes = 60
+	assert.NoError(t, c.Validate())
+
+	c.Unleash.DatabasePoolIdleTimeoutMinMs = 100
+	assert.ErrorContains(t, c.Validate(), "BIFROST_UNLEASH_DATABASE_POOL_IDLE_TIMEOUT_MIN_MS must not be greater than")
+
+	c.Unleash.DatabasePoolIdleTimeoutMaxMs = 60000
+	assert.NoError(t, c.Validate())
+
+	c.Unleash.ExtraEgressFQDNs = "logs.example.com, hooks.example.com"
+	assert.NoError(t, c.Validate())
+
+	c.Unleash.ExtraEgressFQDNs = "logs.example.com,https://not-a-hostname/"
+	assert.EqualError(t, c.Validate(), `invalid FQDN "https://not-a-hostname/" in BIFROST_UNLEASH_EXTRA_EGRESS_FQDNS`)
+
+	c.Unleash.ExtraEgressFQDNs = ""
+	c.Unleash.SQLInstances = "sql-a:europe-north1:10.0.0.1, sql-b:europe-north1:10.0.0.2"
+	assert.NoError(t, c.Validate())
+
+	c.Unleash.SQLInstances = "sql-a:europe-north1"
+	assert.ErrorContains(t, c.Validate(), `invalid SQL instance "sql-a:europe-north1"`)
+
+	c.Unleash.SQLInstances = "sql-a:europe-north1:not-an-ip"
+	assert.ErrorContains(t, c.Validate(), `invalid address "not-an-ip" for SQL instance sql-a`)
+}
+
+func TestParseSQLInstances(t *testing.T) {
+	u := &UnleashConfig{}
+	instances, err := u.ParseSQLInstances()
+	assert.NoError(t, err)
+	assert.Empty(t, instances)
+
+	u.SQLInstances = "sql-a:europe-north1:10.0.0.1,sql-b:europe-west1:10.0.0.2"
+	instances, err = u.ParseSQLInstances()
+	assert.NoError(t, err)
+	assert.Equal(t, []SQLInstance{
+		{ID: "sql-a", Region: "europe-north1", Address: "10.0.0.1"},
+		{ID: "sql-b", Region: "europe-west1", Address: "10.0.0.2"},
+	}, instances)
+}
+
+func TestParseRateLimits(t *testing.T) {
+	s := &ServerConfig{}
+	limits, err := s.ParseRateLimits()
+	assert.NoError(t, err)
+	assert.Empty(t, limits)
+
+	s.RateLimits = "post:10:5, DELETE:2:1"
+	limits, err = s.ParseRateLimits()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]RateLimit{"POST": {PerMinute: 10, Burst: 5}, "DELETE": {PerMinute: 2, Burst: 1}}, limits)
+
+	s.RateLimits = "POST:10"
+	_, err = s.ParseRateLimits()
+	assert.ErrorContains(t, err, `invalid rate limit "POST:10"`)
+
+	s.RateLimits = "POST:0:5"
+	_, err = s.ParseRateLimits()
+	assert.ErrorContains(t, err, `invalid requests per minute "0" for POST`)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 )
@@ -81,6 +82,10 @@ type UnleashVersion struct {
 	GitTag        string
 }
 
+func UnleashVersionFromTag(tag string) (UnleashVersion, error) {
+	return tagToUnleashVersion(tag)
+}
+
 func UnleashVersions() ([]UnleashVersion, error) {
 	tags, err := getLatestTags(unleashRepoOwner, unleashRepoName)
 	if err != nil {
@@ -98,3 +103,32 @@ func UnleashVersions() ([]UnleashVersion, error) {
 
 	return versions, nil
 }
+
+func commonPrefixLength(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// SuggestVersions returns up to limit git tags from versions that share the longest prefix with tag.
+func SuggestVersions(versions []UnleashVersion, tag string, limit int) []string {
+	candidates := []UnleashVersion{}
+	for _, version := range versions {
+		if commonPrefixLength(version.GitTag, tag) > 1 {
+			candidates = append(candidates, version)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return commonPrefixLength(candidates[i].GitTag, tag) > commonPrefixLength(candidates[j].GitTag, tag)
+	})
+
+	suggestions := []string{}
+	for i := 0; i < len(candidates) && i < limit; i++ {
+		suggestions = append(suggestions, candidates[i].GitTag)
+	}
+
+	return suggestions
+}
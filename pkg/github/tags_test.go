@@ -189,3 +189,15 @@ func TestGetLatestTags(t *testing.T) {
 		})
 	}
 }
+
+func TestSuggestVersions(t *testing.T) {
+	versions := []UnleashVersion{
+		{GitTag: "v5.11.0-20240401-000000-abcdef0"},
+		{GitTag: "v5.10.2-20240329-070801-0180a96"},
+		{GitTag: "v4.22.0-20230101-000000-7654321"},
+	}
+
+	assert.Equal(t, []string{"v5.10.2-20240329-070801-0180a96", "v5.11.0-20240401-000000-abcdef0"}, SuggestVersions(versions, "v5.10.9-20240329-070801-0180a96", 2))
+	assert.Equal(t, []string{"v4.22.0-20230101-000000-7654321"}, SuggestVersions(versions, "v4.22.0", 3))
+	assert.Empty(t, SuggestVersions(versions, "latest", 3))
+}
@@ -1,21 +1,107 @@
 package handler
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
 	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/github"
 	"github.com/nais/bifrost/pkg/unleash"
 	"github.com/sirupsen/logrus"
 )
 
 type Handler struct {
-	config         *config.Config
-	logger         *logrus.Logger
-	unleashService unleash.IUnleashService
+	config          *config.Config
+	logger          *logrus.Logger
+	unleashService  unleash.IUnleashService
+	policyEvaluator unleash.PolicyEvaluator
+	unleashVersions func() ([]github.UnleashVersion, error)
 }
 
 func NewHandler(config *config.Config, logger *logrus.Logger, unleashService unleash.IUnleashService) *Handler {
 	return &Handler{
-		config:         config,
-		logger:         logger,
-		unleashService: unleashService,
+		config:          config,
+		logger:          logger,
+		unleashService:  unleashService,
+		policyEvaluator: unleash.NewPolicyEvaluator(config),
+		unleashVersions: github.UnleashVersions,
+	}
+}
+
+// getUnleashVersions returns the Unleash versions released on Github, and whether the list came from Github. When
+// Github can not be reached the list holds only the configured default version, if any.
+func (h *Handler) getUnleashVersions(ctx context.Context) ([]github.UnleashVersion, bool) {
+	log := h.logger.WithContext(ctx)
+
+	versions, err := h.unleashVersions()
+	if err != nil {
+		log.WithError(err).Error("Error getting Unleash versions from Github")
+	} else if len(versions) > 0 {
+		return versions, true
+	}
+
+	if h.config.Unleash.DefaultVersion == "" {
+		return []github.UnleashVersion{}, false
+	}
+
+	version, err := github.UnleashVersionFromTag(h.config.Unleash.DefaultVersion)
+	if err != nil {
+		log.WithError(err).Warn("Fallback Unleash version is not a valid release tag")
+		version = github.UnleashVersion{GitTag: h.config.Unleash.DefaultVersion}
+	}
+
+	log.Warnf("Using fallback Unleash version %s", version.GitTag)
+
+	return []github.UnleashVersion{version}, false
+}
+
+func (h *Handler) renderJSON(c *gin.Context, code int, obj any) {
+	if c.Query("pretty") == "true" {
+		c.IndentedJSON(code, obj)
+		return
 	}
+
+	c.JSON(code, obj)
+}
+
+// renderJSONWithETag renders obj with an ETag computed from its JSON encoding and responds
+// 304 Not Modified when the client already has the same representation.
+func (h *Handler) renderJSONWithETag(c *gin.Context, obj any) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		h.renderJSON(c, 500, gin.H{"error": "Error encoding response"})
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	c.Header("ETag", etag)
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(304)
+		return
+	}
+
+	h.renderJSON(c, 200, obj)
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using the weak comparison from
+// RFC 9110 section 13.1.2 so W/ prefixed tags match as well.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+
+	return false
 }
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,12 +17,59 @@ import (
 	"github.com/nais/bifrost/pkg/utils"
 
 	unleashv1 "github.com/nais/unleasherator/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
 func (h *Handler) HealthHandler(c *gin.Context) {
 	c.String(200, "OK")
 }
 
+const readinessTimeout = 3 * time.Second
+
+func (h *Handler) ReadinessHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	if _, err := h.unleashService.List(ctx); err != nil {
+		h.logger.WithError(err).Warn("Readiness check failed")
+		c.JSON(503, gin.H{
+			"status":     "unavailable",
+			"dependency": "kubernetes",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"status": "ok"})
+}
+
+type InstancesHealth struct {
+	Ready             bool `json:"ready"`
+	Instances         int  `json:"instances"`
+	ReadyInstances    int  `json:"ready-instances"`
+	NotReadyInstances int  `json:"not-ready-instances"`
+}
+
+func (h *Handler) InstancesHealthHandler(c *gin.Context) {
+	instances, err := h.unleashService.List(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Error listing Unleash instances for health summary")
+		c.JSON(503, gin.H{"error": "Error getting unleash instances"})
+		return
+	}
+
+	health := InstancesHealth{Instances: len(instances)}
+	for _, instance := range instances {
+		if instance.IsReady() {
+			health.ReadyInstances++
+		} else {
+			health.NotReadyInstances++
+		}
+	}
+	health.Ready = health.NotReadyInstances == 0
+
+	h.renderJSON(c, 200, health)
+}
+
 func (h *Handler) ErrorHandler(c *gin.Context) {
 	c.Next()
 
@@ -32,6 +83,64 @@ func (h *Handler) ErrorHandler(c *gin.Context) {
 	}
 }
 
+func paginateInstances(c *gin.Context, instances []*unleash.UnleashInstance) ([]*unleash.UnleashInstance, int, error) {
+	if prefix := c.Query("name_prefix"); prefix != "" {
+		filtered := []*unleash.UnleashInstance{}
+		for _, instance := range instances {
+			if strings.HasPrefix(instance.Name, prefix) {
+				filtered = append(filtered, instance)
+			}
+		}
+		instances = filtered
+	}
+
+	if value := c.Query("ready"); value != "" {
+		ready, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, len(instances), fmt.Errorf("invalid ready %q", value)
+		}
+
+		filtered := []*unleash.UnleashInstance{}
+		for _, instance := range instances {
+			if instance.IsReady() == ready {
+				filtered = append(filtered, instance)
+			}
+		}
+		instances = filtered
+	}
+
+	total := len(instances)
+
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return nil, total, fmt.Errorf("invalid offset %q", value)
+		}
+		if offset > len(instances) {
+			offset = len(instances)
+		}
+		instances = instances[offset:]
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return nil, total, fmt.Errorf("invalid limit %q", value)
+		}
+		if limit < len(instances) {
+			instances = instances[:limit]
+		}
+	}
+
+	return instances, total, nil
+}
+
+// UnleashListItem is the Unleash resource with the readiness bifrost derives from its status.
+type UnleashListItem struct {
+	*unleashv1.Unleash
+	Ready bool `json:"ready"`
+}
+
 func (h *Handler) UnleashIndex(c *gin.Context) {
 	ctx := c.Request.Context()
 	instances, err := h.unleashService.List(ctx)
@@ -42,6 +151,45 @@ func (h *Handler) UnleashIndex(c *gin.Context) {
 		return
 	}
 
+	// archived=true includes archived instances and archived=only lists nothing else, they are excluded by default
+	switch archivedFilter := c.DefaultQuery("archived", "false"); archivedFilter {
+	case "false":
+	case "true", "only":
+		archived, err := h.unleashService.ListArchived(ctx)
+		if err != nil {
+			_ = c.Error(err).
+				SetType(gin.ErrorTypePublic).
+				SetMeta("Error getting archived unleash instances")
+			return
+		}
+		if archivedFilter == "only" {
+			instances = archived
+		} else {
+			instances = append(instances, archived...)
+		}
+	default:
+		h.indexBadRequest(c, fmt.Sprintf("invalid archived %q, expected true, false or only", archivedFilter))
+		return
+	}
+
+	instances, total, err := paginateInstances(c, instances)
+	if err != nil {
+		h.indexBadRequest(c, err.Error())
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(total))
+
+	if c.ContentType() == "application/json" {
+		servers := make([]UnleashListItem, 0, len(instances))
+		for _, instance := range instances {
+			servers = append(servers, UnleashListItem{Unleash: instance.ServerInstance, Ready: instance.IsReady()})
+		}
+
+		h.renderJSON(c, 200, servers)
+		return
+	}
+
 	status := template.HTMLEscapeString(c.Query("status"))
 	c.HTML(200, "unleash-index.html", gin.H{
 		"title":     "Unleash as a Service (UaaS))",
@@ -50,12 +198,17 @@ func (h *Handler) UnleashIndex(c *gin.Context) {
 	})
 }
 
-func (h *Handler) UnleashNew(c *gin.Context) {
-	unleashVersions, err := github.UnleashVersions()
-	if err != nil {
-		h.logger.WithError(err).Error("Error getting Unleash versions from Github")
-		unleashVersions = []github.UnleashVersion{}
+// indexBadRequest responds 400 with reason, as JSON when the client asked for JSON.
+func (h *Handler) indexBadRequest(c *gin.Context, reason string) {
+	if c.ContentType() == "application/json" {
+		h.renderJSON(c, 400, gin.H{"error": reason})
+	} else {
+		c.String(400, reason)
 	}
+}
+
+func (h *Handler) UnleashNew(c *gin.Context) {
+	unleashVersions, _ := h.getUnleashVersions(c.Request.Context())
 
 	obj := unleash.UnleashDefinition(h.config, &unleash.UnleashConfig{Name: "my-unleash"})
 	yamlString, err := utils.StructToYaml(obj)
@@ -64,9 +217,14 @@ func (h *Handler) UnleashNew(c *gin.Context) {
 		yamlString = "Parse error - see logs"
 	}
 
+	customVersion := ""
+	if len(unleashVersions) > 0 {
+		customVersion = unleashVersions[0].GitTag
+	}
+
 	uc := unleash.UnleashConfig{
 		Name:                      "",
-		CustomVersion:             unleashVersions[0].GitTag,
+		CustomVersion:             customVersion,
 		EnableFederation:          true,
 		FederationNonce:           "",
 		AllowedTeams:              "",
@@ -96,7 +254,11 @@ func (h *Handler) UnleashInstanceMiddleware(c *gin.Context) {
 	instance, err := h.unleashService.Get(ctx, teamName)
 	if err != nil {
 		h.logger.Info(err)
-		c.Redirect(301, "/unleash?status=not-found")
+		if c.ContentType() == "application/json" {
+			h.renderJSON(c, 404, gin.H{"error": "Instance not found"})
+		} else {
+			c.Redirect(301, "/unleash?status=not-found")
+		}
 		c.Abort()
 		return
 	}
@@ -105,8 +267,43 @@ func (h *Handler) UnleashInstanceMiddleware(c *gin.Context) {
 	c.Next()
 }
 
+type UnleashInstanceDetail struct {
+	Name          string                            `json:"name"`
+	Spec          unleashv1.UnleashSpec             `json:"spec"`
+	Status        unleashv1.UnleashStatus           `json:"status"`
+	Image         string                            `json:"image"`
+	Federation    unleashv1.UnleashFederationConfig `json:"federation"`
+	Egress        *unleash.EgressSummary            `json:"egress"`
+	RuntimeConfig *unleash.UnleashRuntimeConfig     `json:"runtime-config"`
+}
+
+func (h *Handler) unleashInstanceDetail(c *gin.Context, instance *unleash.UnleashInstance) {
+	egress, err := h.unleashService.Egress(c.Request.Context(), instance.Name)
+	if err != nil {
+		h.logger.WithError(err).Error("Error getting egress summary")
+		h.renderJSON(c, 500, gin.H{"error": "Error getting egress summary"})
+		return
+	}
+
+	h.renderJSONWithETag(c, UnleashInstanceDetail{
+		Name:          instance.Name,
+		Spec:          instance.ServerInstance.Spec,
+		Status:        instance.ServerInstance.Status,
+		Image:         instance.ServerInstance.Spec.CustomImage,
+		Federation:    instance.ServerInstance.Spec.Federation,
+		Egress:        egress,
+		RuntimeConfig: instance.RuntimeConfig(),
+	})
+}
+
 func (h *Handler) UnleashInstanceShow(c *gin.Context) {
 	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	if c.Query("detail") == "full" {
+		h.unleashInstanceDetail(c, instance)
+		return
+	}
+
 	instanceYaml, err := utils.StructToYaml(instance.ServerInstance)
 	if err != nil {
 		h.logger.WithError(err).Error("Error converting Unleash struct to yaml")
@@ -115,16 +312,21 @@ func (h *Handler) UnleashInstanceShow(c *gin.Context) {
 
 	uc := unleash.UnleashVariables(instance.ServerInstance, false)
 
+	sqlInstance, err := unleash.SQLInstanceForServer(h.config, instance.ServerInstance)
+	if err != nil {
+		h.logger.WithError(err).Warn("SQL instance for Unleash instance is not configured")
+	}
+
 	c.HTML(200, "unleash-show.html", gin.H{
 		"title":              "Unleash: " + instance.Name,
 		"instance":           instance,
 		"unleash":            uc,
 		"googleProjectID":    h.config.Google.ProjectID,
 		"googleProjectURL":   h.config.GoogleProjectURL(""),
-		"sqlInstanceID":      h.config.Unleash.SQLInstanceID,
-		"sqlInstanceURL":     h.config.GoogleProjectURL(fmt.Sprintf("sql/instances/%s/overview", h.config.Unleash.SQLInstanceID)),
-		"sqlInstanceAddress": h.config.Unleash.SQLInstanceAddress,
-		"sqlInstanceRegion":  h.config.Unleash.SQLInstanceRegion,
+		"sqlInstanceID":      sqlInstance.ID,
+		"sqlInstanceURL":     h.config.GoogleProjectURL(fmt.Sprintf("sql/instances/%s/overview", sqlInstance.ID)),
+		"sqlInstanceAddress": sqlInstance.Address,
+		"sqlInstanceRegion":  sqlInstance.Region,
 		"sqlDatabaseName":    instance.Name,
 		"sqlDatabaseUser":    instance.Name,
 		"sqlDatabaseSecret":  instance.Name,
@@ -133,17 +335,166 @@ func (h *Handler) UnleashInstanceShow(c *gin.Context) {
 	})
 }
 
-func (h *Handler) UnleashInstanceEdit(c *gin.Context) {
+func (h *Handler) UnleashInstanceRuntimeConfig(c *gin.Context) {
 	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
 
-	uc := unleash.UnleashVariables(instance.ServerInstance, true)
+	h.renderJSON(c, 200, instance.RuntimeConfig())
+}
+
+func (h *Handler) UnleashInstanceChecksum(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	h.renderJSON(c, 200, instance.ConfigChecksum())
+}
+
+func (h *Handler) UnleashInstanceManifest(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+	manifest := instance.Manifest()
+
+	if c.ContentType() == "application/json" || c.NegotiateFormat("application/yaml", "application/json") == "application/json" {
+		h.renderJSON(c, 200, manifest)
+		return
+	}
+
+	manifestYaml, err := utils.StructToYaml(manifest)
+	if err != nil {
+		h.logger.WithError(err).Error("Error converting Unleash manifest to yaml")
+		c.String(500, "Error converting Unleash manifest to yaml")
+		return
+	}
+
+	c.Data(200, "application/yaml; charset=utf-8", []byte(manifestYaml))
+}
+
+type UnleashInstanceStatus struct {
+	Name            string `json:"name"`
+	Status          string `json:"status"`
+	Ready           bool   `json:"ready"`
+	Version         string `json:"version"`
+	SecretMissing   bool   `json:"secret-missing"`
+	DesiredReplicas int32  `json:"desired-replicas"`
+	ReadyReplicas   int32  `json:"ready-replicas"`
+	ReplicaMismatch bool   `json:"replica-mismatch"`
+}
+
+func (h *Handler) UnleashInstanceStatus(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	secretExists, err := h.unleashService.DatabaseSecretExists(c.Request.Context(), instance.Name)
+	if err != nil {
+		h.logger.WithError(err).Error("Error checking database secret")
+		h.renderJSON(c, 500, gin.H{"error": "Error checking database secret"})
+		return
+	}
+
+	readyReplicas, err := h.unleashService.ReadyReplicas(c.Request.Context(), instance.Name)
+	if err != nil {
+		h.logger.WithError(err).Error("Error getting ready replicas")
+		h.renderJSON(c, 500, gin.H{"error": "Error getting ready replicas"})
+		return
+	}
+
+	desiredReplicas := instance.ServerInstance.Spec.Size
+
+	h.renderJSON(c, 200, UnleashInstanceStatus{
+		Name:            instance.Name,
+		Status:          instance.Status(),
+		Ready:           instance.IsReady(),
+		Version:         instance.Version(),
+		SecretMissing:   !secretExists,
+		DesiredReplicas: desiredReplicas,
+		ReadyReplicas:   readyReplicas,
+		ReplicaMismatch: desiredReplicas != readyReplicas,
+	})
+}
+
+type UnleashInstanceConnection struct {
+	Name               string `json:"name"`
+	APIUrl             string `json:"api-url"`
+	WebUrl             string `json:"web-url"`
+	SecretName         string `json:"secret-name"`
+	SQLInstanceAddress string `json:"sql-instance-address"`
+}
+
+func (h *Handler) UnleashInstanceConnection(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	sqlInstance, err := unleash.SQLInstanceForServer(h.config, instance.ServerInstance)
+	if err != nil {
+		h.logger.WithError(err).Error("Error resolving SQL instance")
+		h.renderJSON(c, 500, gin.H{"error": "Error resolving SQL instance"})
+		return
+	}
+
+	h.renderJSON(c, 200, UnleashInstanceConnection{
+		Name:               instance.Name,
+		APIUrl:             instance.ApiUrl(),
+		WebUrl:             instance.WebUrl(),
+		SecretName:         instance.ServerInstance.Spec.Database.SecretName,
+		SQLInstanceAddress: sqlInstance.Address,
+	})
+}
+
+func (h *Handler) UnleashInstanceRepairSecretPost(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	if !h.config.Unleash.SecretRepairEnabled {
+		h.renderJSON(c, 403, gin.H{"error": "Secret repair is disabled"})
+		return
+	}
+
+	if err := h.unleashService.RepairDatabaseSecret(c.Request.Context(), instance.Name); err != nil {
+		if errors.Is(err, unleash.ErrDatabaseSecretExists) {
+			h.renderJSON(c, 409, gin.H{"error": "Database secret already exists"})
+			return
+		}
+
+		h.logger.WithError(err).Error("Error repairing database secret")
+		h.renderJSON(c, 500, gin.H{"error": "Error repairing database secret"})
+		return
+	}
+
+	h.renderJSON(c, 200, gin.H{"status": "repaired"})
+}
+
+func (h *Handler) UnleashInstanceRotateCredentialsPost(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+	restart := c.Query("restart") == "true"
+
+	if err := h.unleashService.RotateCredentials(c.Request.Context(), instance.Name, restart); err != nil {
+		if errors.Is(err, unleash.ErrDatabaseUserNotFound) {
+			h.renderJSON(c, 404, gin.H{"error": "Database user not found"})
+			return
+		}
+
+		h.logger.WithError(err).Error("Error rotating database credentials")
+		h.renderJSON(c, 500, gin.H{"error": "Error rotating database credentials"})
+		return
+	}
 
-	unleashVersions, err := github.UnleashVersions()
+	h.renderJSON(c, 200, gin.H{"status": "rotated", "restarted": restart})
+}
+
+func (h *Handler) UnleashInstanceEgress(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	summary, err := h.unleashService.Egress(c.Request.Context(), instance.Name)
 	if err != nil {
-		h.logger.WithError(err).Error("Error getting Unleash versions from Github")
-		unleashVersions = []github.UnleashVersion{}
+		h.logger.WithError(err).Error("Error getting egress summary")
+		h.renderJSON(c, 500, gin.H{"error": "Error getting egress summary"})
+		return
 	}
 
+	h.renderJSON(c, 200, summary)
+}
+
+func (h *Handler) UnleashInstanceEdit(c *gin.Context) {
+	instance := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	uc := unleash.UnleashVariables(instance.ServerInstance, true)
+
+	unleashVersions, _ := h.getUnleashVersions(c.Request.Context())
+
 	c.HTML(200, "unleash-form.html", gin.H{
 		"title":           "Edit Unleash: " + instance.Name,
 		"action":          "edit",
@@ -152,6 +503,55 @@ func (h *Handler) UnleashInstanceEdit(c *gin.Context) {
 	})
 }
 
+// validateUnleashConfig runs all config validations and returns every failure, so they can be fixed at once.
+func (h *Handler) validateUnleashConfig(uc *unleash.UnleashConfig) error {
+	return errors.Join(
+		uc.Validate(),
+		uc.ValidateDatabasePoolIdleTimeout(h.config.Unleash.DatabasePoolIdleTimeoutMinMs, h.config.Unleash.DatabasePoolIdleTimeoutMaxMs),
+		uc.ValidateIngressHosts(h.config.Unleash.InstanceWebIngressHost, h.config.Unleash.InstanceAPIIngressHost),
+	)
+}
+
+// newFederationNonce generates a nonce of at least the configured minimum length.
+func (h *Handler) newFederationNonce() string {
+	length := 8
+	if h.config.Unleash.FederationNonceMinLength > length {
+		length = h.config.Unleash.FederationNonceMinLength
+	}
+
+	return utils.RandomString(length)
+}
+
+func isKnownVersion(versions []github.UnleashVersion, tag string) bool {
+	for _, version := range versions {
+		if version.GitTag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+type unknownFieldError struct {
+	Field string
+}
+
+func (e *unknownFieldError) Error() string {
+	return fmt.Sprintf("unknown field %q", e.Field)
+}
+
+// bindStrictJSON decodes the request body into obj and rejects fields that obj does not have.
+func bindStrictJSON(c *gin.Context, obj any) error {
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(obj)
+	if err != nil && strings.HasPrefix(err.Error(), "json: unknown field ") {
+		return &unknownFieldError{Field: strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)}
+	}
+
+	return err
+}
+
 func (h *Handler) UnleashInstancePost(c *gin.Context) {
 	var (
 		title, action string
@@ -174,20 +574,28 @@ func (h *Handler) UnleashInstancePost(c *gin.Context) {
 		uc = unleash.UnleashVariables(instance.ServerInstance, true)
 	}
 
-	unleashVersions, err := github.UnleashVersions()
-	if err != nil {
-		log.WithError(err).Error("Error getting Unleash versions from Github")
-		unleashVersions = []github.UnleashVersion{
-			{
-				GitTag:        "v5.10.2-20240329-070801-0180a96",
-				ReleaseTime:   time.Date(2024, 3, 29, 7, 8, 1, 0, time.UTC),
-				CommitHash:    "0180a96",
-				VersionNumber: "5.10.2",
-			},
-		}
+	currentVersion := uc.CustomVersion
+
+	unleashVersions, versionsFromGithub := h.getUnleashVersions(ctx)
+
+	if c.ContentType() == "application/json" && h.config.Server.StrictJSON {
+		err = bindStrictJSON(c, uc)
+	} else {
+		err = c.ShouldBind(uc)
 	}
 
-	if err = c.ShouldBind(uc); err != nil {
+	var unknownFieldErr *unknownFieldError
+	if errors.As(err, &unknownFieldErr) {
+		log.WithError(err).Warn("Rejecting Unleash config with unknown field")
+		h.renderJSON(c, 400, gin.H{
+			"error":  "unknown_field",
+			"field":  unknownFieldErr.Field,
+			"reason": fmt.Sprintf("Unknown field %q", unknownFieldErr.Field),
+		})
+		return
+	}
+
+	if err != nil {
 		log.WithError(err).Error("Error binding post data to Unleash config")
 
 		_ = c.Error(err).
@@ -200,28 +608,29 @@ func (h *Handler) UnleashInstancePost(c *gin.Context) {
 		uc.Name = instance.(*unleash.UnleashInstance).ServerInstance.GetName()
 		uc.FederationNonce = instance.(*unleash.UnleashInstance).ServerInstance.Spec.Federation.SecretNonce
 	} else {
-		uc.FederationNonce = utils.RandomString(8)
+		uc.FederationNonce = h.newFederationNonce()
 		uc.SetDefaultValues(unleashVersions)
 	}
 
 	//  We are removing the differentiating between teams and namespaces, and merging them into one field
 	uc.MergeTeamsAndNamespaces()
 
-	if validationErr := uc.Validate(); validationErr != nil {
-		log.WithError(validationErr).Error("Error validating Unleash config")
+	if exists {
+		title = "Edit Unleash: " + uc.Name
+		action = "edit"
+	} else {
+		title = "New Unleash Instance"
+		action = "create"
+	}
 
-		if exists {
-			title = "Edit Unleash: " + uc.Name
-			action = "edit"
-		} else {
-			title = "New Unleash Instance"
-			action = "create"
-		}
+	if validationErr := h.validateUnleashConfig(uc); validationErr != nil {
+		log.WithError(validationErr).Error("Error validating Unleash config")
 
 		if c.ContentType() == "application/json" {
-			c.JSON(400, gin.H{
+			h.renderJSON(c, 400, gin.H{
 				"error":           "Input validation failed, see errors in details",
 				"validationError": validationErr.Error(),
+				"details":         unleash.ValidationDetails(validationErr),
 			})
 		} else {
 			c.HTML(400, "unleash-form.html", gin.H{
@@ -236,6 +645,84 @@ func (h *Handler) UnleashInstancePost(c *gin.Context) {
 		return
 	}
 
+	if exists && h.config.Unleash.BlockVersionChangeWhenNotReady && uc.CustomVersion != currentVersion && !instance.(*unleash.UnleashInstance).IsReady() {
+		log.Warn("Rejecting version change for instance that is not ready")
+
+		if c.ContentType() == "application/json" {
+			h.renderJSON(c, 409, gin.H{
+				"error":  "instance_not_ready",
+				"reason": "Version can not be changed while the instance is not ready",
+			})
+		} else {
+			c.HTML(409, "unleash-form.html", gin.H{
+				"title":           title,
+				"action":          action,
+				"unleash":         uc,
+				"unleashVersions": unleashVersions,
+				"error":           "Version can not be changed while the instance is not ready",
+			})
+		}
+		return
+	}
+
+	verifyVersion := h.config.Unleash.VerifyCustomVersion && uc.CustomVersion != "" && uc.CustomVersion != currentVersion
+	if verifyVersion && !versionsFromGithub {
+		log.Warnf("Not verifying Unleash version %s, the released versions could not be fetched from Github", uc.CustomVersion)
+	} else if verifyVersion && !isKnownVersion(unleashVersions, uc.CustomVersion) {
+		log.Warnf("Rejecting unknown Unleash version %s", uc.CustomVersion)
+
+		suggestions := github.SuggestVersions(unleashVersions, uc.CustomVersion, 3)
+		if c.ContentType() == "application/json" {
+			h.renderJSON(c, 400, gin.H{
+				"error":       "unknown_version",
+				"reason":      fmt.Sprintf("Unleash version %s does not exist", uc.CustomVersion),
+				"suggestions": suggestions,
+			})
+		} else {
+			c.HTML(400, "unleash-form.html", gin.H{
+				"title":           title,
+				"action":          action,
+				"unleash":         uc,
+				"unleashVersions": unleashVersions,
+				"error":           fmt.Sprintf("Unleash version %s does not exist, did you mean one of: %s", uc.CustomVersion, strings.Join(suggestions, ", ")),
+			})
+		}
+		return
+	}
+
+	operation := unleash.PolicyOperationCreate
+	if exists {
+		operation = unleash.PolicyOperationUpdate
+	}
+
+	if err := h.policyEvaluator.Evaluate(ctx, operation, uc); err != nil {
+		var policyErr *unleash.PolicyViolationError
+		if !errors.As(err, &policyErr) {
+			_ = c.Error(err).
+				SetType(gin.ErrorTypePublic).
+				SetMeta("Error evaluating admission policy")
+			return
+		}
+
+		log.WithError(err).Warn("Unleash config rejected by admission policy")
+
+		if c.ContentType() == "application/json" {
+			h.renderJSON(c, 403, gin.H{
+				"error":  "Rejected by admission policy",
+				"reason": policyErr.Reason,
+			})
+		} else {
+			c.HTML(403, "unleash-form.html", gin.H{
+				"title":           title,
+				"action":          action,
+				"unleash":         uc,
+				"unleashVersions": unleashVersions,
+				"error":           "Rejected by admission policy: " + policyErr.Reason,
+			})
+		}
+		return
+	}
+
 	var unleashInstance *unleashv1.Unleash
 
 	if exists {
@@ -244,6 +731,24 @@ func (h *Handler) UnleashInstancePost(c *gin.Context) {
 		unleashInstance, err = h.unleashService.Create(ctx, uc)
 	}
 
+	if errors.Is(err, unleash.ErrInstanceArchived) {
+		log.Warn("Rejecting create of archived instance")
+
+		reason := fmt.Sprintf("Instance %s is archived, restore it instead", uc.Name)
+		if c.ContentType() == "application/json" {
+			h.renderJSON(c, 409, gin.H{"error": "instance_archived", "reason": reason})
+		} else {
+			c.HTML(409, "unleash-form.html", gin.H{
+				"title":           title,
+				"action":          action,
+				"unleash":         uc,
+				"unleashVersions": unleashVersions,
+				"error":           reason,
+			})
+		}
+		return
+	}
+
 	if err != nil {
 		var unleashErr *unleash.UnleashError
 
@@ -260,7 +765,7 @@ func (h *Handler) UnleashInstancePost(c *gin.Context) {
 	}
 
 	if c.ContentType() == "application/json" {
-		c.JSON(200, unleashInstance)
+		h.renderJSON(c, 200, unleashInstance)
 		return
 	}
 
@@ -291,7 +796,12 @@ func (h *Handler) UnleashInstanceDeletePost(c *gin.Context) {
 		return
 	}
 
-	if err := h.unleashService.Delete(ctx, instance.Name); err != nil {
+	opts := unleash.DeleteOptions{
+		OrphanDatabase: c.PostForm("orphan-database") == "true" || c.Query("orphan_database") == "true",
+		Archive:        c.PostForm("archive") == "true" || c.Query("soft") == "true",
+	}
+
+	if err := h.unleashService.Delete(ctx, instance.Name, opts); err != nil {
 		_ = c.Error(err).
 			SetType(gin.ErrorTypePublic).
 			SetMeta("Error deleting unleash instance")
@@ -300,3 +810,223 @@ func (h *Handler) UnleashInstanceDeletePost(c *gin.Context) {
 
 	c.Redirect(302, "/unleash")
 }
+
+type UnleashCloneRequest struct {
+	Name                string `json:"name" binding:"required"`
+	CopyFederationNonce bool   `json:"copy-federation-nonce"`
+}
+
+func (h *Handler) UnleashInstanceClonePost(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := h.logger.WithContext(ctx)
+	source := c.MustGet("unleashInstance").(*unleash.UnleashInstance)
+
+	var req UnleashCloneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.renderJSON(c, 400, gin.H{"error": "Invalid clone request", "reason": err.Error()})
+		return
+	}
+
+	if _, err := h.unleashService.Get(ctx, req.Name); err == nil {
+		h.renderJSON(c, 409, gin.H{"error": "instance_exists", "reason": fmt.Sprintf("Instance %s already exists", req.Name)})
+		return
+	} else if !apierrors.IsNotFound(err) {
+		log.WithError(err).Error("Error checking if clone target exists")
+		h.renderJSON(c, 500, gin.H{"error": "Error checking if instance exists"})
+		return
+	}
+
+	uc := unleash.UnleashVariables(source.ServerInstance, true)
+	uc.Name = req.Name
+	uc.SQLInstanceID = ""
+	if !req.CopyFederationNonce {
+		uc.FederationNonce = h.newFederationNonce()
+	} else if err := uc.ValidateFederationNonce(h.config.Unleash.FederationNonceMinLength); err != nil {
+		h.renderJSON(c, 400, gin.H{"error": "weak_federation_nonce", "reason": err.Error()})
+		return
+	}
+
+	if validationErr := h.validateUnleashConfig(uc); validationErr != nil {
+		log.WithError(validationErr).Error("Error validating cloned Unleash config")
+		h.renderJSON(c, 400, gin.H{
+			"error":           "Input validation failed, see errors in details",
+			"validationError": validationErr.Error(),
+			"details":         unleash.ValidationDetails(validationErr),
+		})
+		return
+	}
+
+	if err := h.policyEvaluator.Evaluate(ctx, unleash.PolicyOperationCreate, uc); err != nil {
+		var policyErr *unleash.PolicyViolationError
+		if !errors.As(err, &policyErr) {
+			log.WithError(err).Error("Error evaluating admission policy")
+			h.renderJSON(c, 500, gin.H{"error": "Error evaluating admission policy"})
+			return
+		}
+
+		h.renderJSON(c, 403, gin.H{
+			"error":  "Rejected by admission policy",
+			"reason": policyErr.Reason,
+		})
+		return
+	}
+
+	unleashInstance, err := h.unleashService.Create(ctx, uc)
+	if errors.Is(err, unleash.ErrInstanceArchived) {
+		h.renderJSON(c, 409, gin.H{"error": "instance_archived", "reason": fmt.Sprintf("Instance %s is archived, restore it instead", uc.Name)})
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("Error cloning Unleash instance")
+		h.renderJSON(c, 500, gin.H{"error": "Error cloning Unleash instance"})
+		return
+	}
+
+	log.Infof("Cloned Unleash instance %s to %s", source.Name, uc.Name)
+	h.renderJSON(c, 200, unleashInstance)
+}
+
+// UnleashExportItem is the reconstructable config of an instance. The federation nonce is included so federated
+// clients keep working after an import.
+type UnleashExportItem struct {
+	Config          *unleash.UnleashConfig `json:"config"`
+	FederationNonce string                 `json:"federation-nonce"`
+}
+
+type UnleashExport struct {
+	Instances []UnleashExportItem `json:"instances"`
+}
+
+const (
+	ImportStatusCreated  = "created"
+	ImportStatusSkipped  = "skipped"
+	ImportStatusInvalid  = "invalid"
+	ImportStatusRejected = "rejected"
+	ImportStatusFailed   = "failed"
+)
+
+type UnleashImportResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func (h *Handler) UnleashExport(c *gin.Context) {
+	instances, err := h.unleashService.List(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Error getting unleash instances")
+		h.renderJSON(c, 500, gin.H{"error": "Error getting unleash instances"})
+		return
+	}
+
+	export := UnleashExport{Instances: []UnleashExportItem{}}
+	for _, instance := range instances {
+		uc := unleash.UnleashVariables(instance.ServerInstance, true)
+		export.Instances = append(export.Instances, UnleashExportItem{Config: uc, FederationNonce: uc.FederationNonce})
+	}
+
+	h.renderJSON(c, 200, export)
+}
+
+// UnleashImportPost creates the instances in an export, skipping names that already exist. Only config is
+// imported, the instances start with empty databases.
+func (h *Handler) UnleashImportPost(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := h.logger.WithContext(ctx)
+
+	var export UnleashExport
+	if err := c.ShouldBindJSON(&export); err != nil {
+		h.renderJSON(c, 400, gin.H{"error": "Invalid import", "reason": err.Error()})
+		return
+	}
+
+	results := []UnleashImportResult{}
+	for _, item := range export.Instances {
+		if item.Config == nil {
+			results = append(results, UnleashImportResult{Status: ImportStatusInvalid, Reason: "missing config"})
+			continue
+		}
+
+		uc := item.Config
+		uc.FederationNonce = item.FederationNonce
+		uc.SQLInstanceID = ""
+		result := UnleashImportResult{Name: uc.Name}
+
+		if _, err := h.unleashService.Get(ctx, uc.Name); err == nil {
+			result.Status = ImportStatusSkipped
+			result.Reason = "instance already exists"
+			results = append(results, result)
+			continue
+		} else if !apierrors.IsNotFound(err) {
+			log.WithError(err).WithField("instance", uc.Name).Error("Error checking if imported instance exists")
+			result.Status = ImportStatusFailed
+			result.Reason = "error checking if instance exists"
+			results = append(results, result)
+			continue
+		}
+
+		if err := errors.Join(uc.ValidateFederationNonce(h.config.Unleash.FederationNonceMinLength), h.validateUnleashConfig(uc)); err != nil {
+			result.Status = ImportStatusInvalid
+			result.Reason = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		if err := h.policyEvaluator.Evaluate(ctx, unleash.PolicyOperationCreate, uc); err != nil {
+			var policyErr *unleash.PolicyViolationError
+			if errors.As(err, &policyErr) {
+				result.Status = ImportStatusRejected
+				result.Reason = policyErr.Reason
+			} else {
+				log.WithError(err).Error("Error evaluating admission policy")
+				result.Status = ImportStatusFailed
+				result.Reason = "error evaluating admission policy"
+			}
+			results = append(results, result)
+			continue
+		}
+
+		if _, err := h.unleashService.Create(ctx, uc); errors.Is(err, unleash.ErrInstanceArchived) {
+			result.Status = ImportStatusSkipped
+			result.Reason = "instance is archived, restore it instead"
+			results = append(results, result)
+			continue
+		} else if err != nil {
+			log.WithError(err).WithField("instance", uc.Name).Error("Error importing Unleash instance")
+			result.Status = ImportStatusFailed
+			result.Reason = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		log.Infof("Imported Unleash instance %s", uc.Name)
+		result.Status = ImportStatusCreated
+		results = append(results, result)
+	}
+
+	h.renderJSON(c, 200, gin.H{"results": results})
+}
+
+func (h *Handler) UnleashInstanceRestorePost(c *gin.Context) {
+	name := c.Param("id")
+
+	server, err := h.unleashService.Restore(c.Request.Context(), name)
+	if err != nil {
+		if errors.Is(err, unleash.ErrInstanceNotArchived) || apierrors.IsNotFound(err) {
+			h.renderJSON(c, 404, gin.H{"error": "No archived instance found"})
+			return
+		}
+
+		_ = c.Error(err).
+			SetType(gin.ErrorTypePublic).
+			SetMeta("Error restoring unleash instance")
+		return
+	}
+
+	if c.ContentType() == "application/json" {
+		h.renderJSON(c, 200, server)
+		return
+	}
+
+	c.Redirect(302, "/unleash/"+server.GetName()+"/")
+}
@@ -1 +1,153 @@
 package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/github"
+	"github.com/nais/bifrost/pkg/unleash"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetUnleashVersionsFallback(t *testing.T) {
+	githubDown := func() ([]github.UnleashVersion, error) {
+		return nil, errors.New("github is unreachable")
+	}
+
+	t.Run("uses versions from github", func(t *testing.T) {
+		h := NewHandler(&config.Config{}, logrus.New(), nil)
+		h.unleashVersions = func() ([]github.UnleashVersion, error) {
+			return []github.UnleashVersion{{GitTag: "v5.11.0-20240401-000000-abcdef0"}}, nil
+		}
+
+		versions, fromGithub := h.getUnleashVersions(context.Background())
+		assert.True(t, fromGithub)
+		assert.Len(t, versions, 1)
+		assert.Equal(t, "v5.11.0-20240401-000000-abcdef0", versions[0].GitTag)
+	})
+
+	t.Run("uses configured default when github fails", func(t *testing.T) {
+		c := &config.Config{Unleash: config.UnleashConfig{DefaultVersion: "v5.10.2-20240329-070801-0180a96"}}
+		h := NewHandler(c, logrus.New(), nil)
+		h.unleashVersions = githubDown
+
+		versions, fromGithub := h.getUnleashVersions(context.Background())
+		assert.False(t, fromGithub)
+		assert.Len(t, versions, 1)
+		assert.Equal(t, "v5.10.2-20240329-070801-0180a96", versions[0].GitTag)
+		assert.Equal(t, "5.10.2", versions[0].VersionNumber)
+		assert.Equal(t, "0180a96", versions[0].CommitHash)
+	})
+
+	t.Run("keeps non release tag as is", func(t *testing.T) {
+		c := &config.Config{Unleash: config.UnleashConfig{DefaultVersion: "latest"}}
+		h := NewHandler(c, logrus.New(), nil)
+		h.unleashVersions = githubDown
+
+		versions, _ := h.getUnleashVersions(context.Background())
+		assert.Len(t, versions, 1)
+		assert.Equal(t, "latest", versions[0].GitTag)
+	})
+
+	t.Run("returns empty list without default", func(t *testing.T) {
+		h := NewHandler(&config.Config{}, logrus.New(), nil)
+		h.unleashVersions = githubDown
+
+		versions, fromGithub := h.getUnleashVersions(context.Background())
+		assert.False(t, fromGithub)
+		assert.Empty(t, versions)
+	})
+}
+
+type fakeUnleashService struct {
+	unleash.IUnleashService
+	created []*unleash.UnleashConfig
+}
+
+func (s *fakeUnleashService) Create(ctx context.Context, uc *unleash.UnleashConfig) (*unleashv1.Unleash, error) {
+	s.created = append(s.created, uc)
+	return &unleashv1.Unleash{ObjectMeta: metav1.ObjectMeta{Name: uc.Name}}, nil
+}
+
+func TestUnleashInstancePostVerifyCustomVersion(t *testing.T) {
+	c := &config.Config{Unleash: config.UnleashConfig{
+		VerifyCustomVersion:          true,
+		DatabasePoolIdleTimeoutMinMs: 100,
+		DatabasePoolIdleTimeoutMaxMs: 60000,
+	}}
+	service := &fakeUnleashService{}
+	h := NewHandler(c, logrus.New(), service)
+	h.unleashVersions = func() ([]github.UnleashVersion, error) {
+		return []github.UnleashVersion{
+			{GitTag: "v5.11.0-20240401-000000-abcdef0"},
+			{GitTag: "v5.10.2-20240329-070801-0180a96"},
+			{GitTag: "v5.10.1-20240301-000000-1234567"},
+			{GitTag: "v4.22.0-20230101-000000-7654321"},
+		}, nil
+	}
+
+	router := gin.New()
+	router.POST("/unleash/new", h.UnleashInstancePost)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/unleash/new", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(`{"name": "my-name", "custom-version": "v5.10.3-20240330-000000-0000000"}`)
+	assert.Equal(t, 400, w.Code)
+	assert.JSONEq(t, `{
+		"error": "unknown_version",
+		"reason": "Unleash version v5.10.3-20240330-000000-0000000 does not exist",
+		"suggestions": ["v5.10.2-20240329-070801-0180a96", "v5.10.1-20240301-000000-1234567", "v5.11.0-20240401-000000-abcdef0"]
+	}`, w.Body.String())
+	assert.Empty(t, service.created)
+
+	w = post(`{"name": "my-name", "custom-version": "v5.10.2-20240329-070801-0180a96"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Len(t, service.created, 1)
+
+	c.Unleash.VerifyCustomVersion = false
+	w = post(`{"name": "my-name", "custom-version": "v5.10.3-20240330-000000-0000000"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Len(t, service.created, 2)
+}
+
+func TestUnleashInstancePostVerifyCustomVersionGithubDown(t *testing.T) {
+	c := &config.Config{Unleash: config.UnleashConfig{
+		VerifyCustomVersion:          true,
+		DefaultVersion:               "v5.10.2-20240329-070801-0180a96",
+		DatabasePoolIdleTimeoutMinMs: 100,
+		DatabasePoolIdleTimeoutMaxMs: 60000,
+	}}
+	service := &fakeUnleashService{}
+	h := NewHandler(c, logrus.New(), service)
+	h.unleashVersions = func() ([]github.UnleashVersion, error) {
+		return nil, errors.New("github is unreachable")
+	}
+
+	router := gin.New()
+	router.POST("/unleash/new", h.UnleashInstancePost)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/unleash/new", strings.NewReader(`{"name": "my-name", "custom-version": "v5.11.0-20240401-000000-abcdef0"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	if assert.Len(t, service.created, 1) {
+		assert.Equal(t, "v5.11.0-20240401-000000-abcdef0", service.created[0].CustomVersion)
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "bifrost"
+
+var (
+	UnleashOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "unleash_operations_total",
+		Help:      "Number of Unleash instance operations by operation and outcome.",
+	}, []string{"operation", "outcome"})
+
+	unleashInstances = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "unleash_instances",
+		Help:      "Number of Unleash instances by reported version.",
+	}, []string{"version"})
+
+	DatabaseOperationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "database_operation_errors_total",
+		Help:      "Number of failed database, database user and database secret operations by operation and error class.",
+	}, []string{"operation", "class"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+)
+
+func ObserveUnleashOperation(operation string, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+
+	UnleashOperations.WithLabelValues(operation, outcome).Inc()
+}
+
+func ObserveDatabaseOperationError(operation, class string) {
+	DatabaseOperationErrors.WithLabelValues(operation, class).Inc()
+}
+
+func SetUnleashInstances(versions map[string]int) {
+	unleashInstances.Reset()
+	for version, count := range versions {
+		unleashInstances.WithLabelValues(version).Set(float64(count))
+	}
+}
+
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
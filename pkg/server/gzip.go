@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// acceptsGzip reports whether an Accept-Encoding header accepts gzip, as described in RFC 9110 section 12.5.3.
+// An explicit gzip coding takes precedence over *, and a q-value of 0 means the coding is not acceptable.
+func acceptsGzip(acceptEncoding string) bool {
+	gzipQ, wildcardQ := -1.0, -1.0
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "gzip", "x-gzip":
+			gzipQ = q
+		case "*":
+			wildcardQ = q
+		}
+	}
+
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return wildcardQ > 0
+}
+
+// gzipMiddleware buffers the response and compresses it when the client accepts gzip
+// and the body is at least minSize bytes. HEAD requests and responses without a body are never compressed.
+func gzipMiddleware(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		if c.Request.Method == http.MethodHead || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		writer := &bufferedResponseWriter{ResponseWriter: original}
+		c.Writer = writer
+		c.Next()
+		c.Writer = original
+
+		header := original.Header()
+		status := writer.Status()
+		if writer.body.Len() < minSize || header.Get("Content-Encoding") != "" ||
+			status == http.StatusNoContent || status == http.StatusNotModified {
+			_, _ = original.Write(writer.body.Bytes())
+			return
+		}
+
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+
+		gz := gzip.NewWriter(original)
+		_, _ = gz.Write(writer.body.Bytes())
+		_ = gz.Close()
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/config"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/idtoken"
+)
+
+// iapJWTHeader is set by Identity-Aware Proxy to a signed assertion for the authenticated user.
+const iapJWTHeader = "X-Goog-IAP-JWT-Assertion"
+
+// rateLimitSweepInterval is how often idle limiters are evicted.
+const rateLimitSweepInterval = time.Minute
+
+// iapVerifier verifies an IAP JWT assertion and returns the email of the authenticated user.
+type iapVerifier func(ctx context.Context, token string) (string, error)
+
+func newIAPVerifier(audience string) iapVerifier {
+	return func(ctx context.Context, token string) (string, error) {
+		payload, err := idtoken.Validate(ctx, token, audience)
+		if err != nil {
+			return "", err
+		}
+
+		email, _ := payload.Claims["email"].(string)
+		if email == "" {
+			return "", fmt.Errorf("iap assertion has no email claim")
+		}
+
+		return email, nil
+	}
+}
+
+type callerLimiter struct {
+	limiter  *rate.Limiter
+	idle     time.Duration
+	lastSeen time.Time
+}
+
+type rateLimiter struct {
+	limits map[string]config.RateLimit
+	now    func() time.Time
+
+	mu        sync.Mutex
+	limiters  map[string]*callerLimiter
+	lastSweep time.Time
+}
+
+func (l *rateLimiter) limiter(method, caller string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	key := method + " " + caller
+	entry, ok := l.limiters[key]
+	if !ok {
+		limit := l.limits[method]
+		every := time.Minute / time.Duration(limit.PerMinute)
+		// A limiter idle for long enough to refill its bucket is equal to a new one, so it can be evicted
+		entry = &callerLimiter{limiter: rate.NewLimiter(rate.Every(every), limit.Burst), idle: every * time.Duration(limit.Burst)}
+		l.limiters[key] = entry
+	}
+	entry.lastSeen = now
+
+	return entry.limiter
+}
+
+// sweep evicts limiters that have been idle long enough to refill, must be called with mu held.
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, entry := range l.limiters {
+		if now.Sub(entry.lastSeen) >= entry.idle {
+			delete(l.limiters, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// rateLimitMiddleware limits requests per caller for the methods in limits, other methods are not limited.
+// Callers are identified by their IAP user when verify accepts the IAP assertion, and by client IP otherwise.
+func rateLimitMiddleware(limits map[string]config.RateLimit, verify iapVerifier) gin.HandlerFunc {
+	l := &rateLimiter{limits: limits, now: time.Now, limiters: map[string]*callerLimiter{}}
+
+	return func(c *gin.Context) {
+		if _, ok := limits[c.Request.Method]; !ok {
+			c.Next()
+			return
+		}
+
+		caller := c.ClientIP()
+		if token := c.GetHeader(iapJWTHeader); token != "" && verify != nil {
+			if email, err := verify(c.Request.Context(), token); err == nil {
+				caller = email
+			}
+		}
+
+		reservation := l.limiter(c.Request.Method, caller).Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+
+			c.Header("Retry-After", fmt.Sprintf("%d", int(math.Ceil(delay.Seconds()))))
+			if c.ContentType() == "application/json" {
+				c.AbortWithStatusJSON(429, gin.H{"error": "Too many requests"})
+			} else {
+				c.String(429, "Too many requests")
+				c.Abort()
+			}
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -2,16 +2,24 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	fqdnV1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
 	"github.com/gin-gonic/gin"
 	"github.com/nais/bifrost/pkg/config"
 	"github.com/nais/bifrost/pkg/handler"
+	"github.com/nais/bifrost/pkg/metrics"
 	"github.com/nais/bifrost/pkg/server/utils"
+	"github.com/nais/bifrost/pkg/tracing"
 	"github.com/nais/bifrost/pkg/unleash"
 	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	admin "google.golang.org/api/sqladmin/v1beta4"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -79,12 +87,40 @@ func initLogger() *logrus.Logger {
 	return logger
 }
 
+const instanceMetricsInterval = time.Minute
+
+func refreshInstanceMetrics(ctx context.Context, unleashService unleash.IUnleashService, logger *logrus.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		instances, err := unleashService.List(ctx)
+		if err != nil {
+			logger.WithError(err).Warn("Error listing Unleash instances for metrics")
+		} else {
+			versions := map[string]int{}
+			for _, instance := range instances {
+				versions[instance.Version()]++
+			}
+			metrics.SetUnleashInstances(versions)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func setupRouter(config *config.Config, logger *logrus.Logger, unleashService unleash.IUnleashService) *gin.Engine {
 	router := gin.Default()
 	gin.DefaultWriter = logger.Writer()
 
 	h := handler.NewHandler(config, logger, unleashService)
 
+	router.Use(tracing.GinMiddleware())
+	router.Use(metrics.GinMiddleware())
 	router.Use(h.ErrorHandler)
 	router.Static("/assets", "./assets")
 
@@ -94,17 +130,41 @@ func setupRouter(config *config.Config, logger *logrus.Logger, unleashService un
 	})
 
 	router.GET("/healthz", h.HealthHandler)
+	router.GET("/healthz/instances", h.InstancesHealthHandler)
+	router.GET("/readyz", h.ReadinessHandler)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	unleash := router.Group("/unleash")
+	if config.Server.GzipEnabled {
+		unleash.Use(gzipMiddleware(config.Server.GzipMinSize))
+	}
+	if limits, _ := config.Server.ParseRateLimits(); len(limits) > 0 {
+		unleash.Use(rateLimitMiddleware(limits, newIAPVerifier(config.GoogleIAPAudience())))
+	}
+	if config.Server.RequestTimeout > 0 {
+		unleash.Use(timeoutMiddleware(time.Duration(config.Server.RequestTimeout) * time.Second))
+	}
 	{
 		unleash.GET("/", h.UnleashIndex)
 		unleash.GET("/new", h.UnleashNew)
 		unleash.POST("/new", h.UnleashInstancePost)
+		unleash.GET("/export", h.UnleashExport)
+		unleash.POST("/import", h.UnleashImportPost)
+		unleash.POST("/:id/restore", h.UnleashInstanceRestorePost)
 
 		unleashInstance := unleash.Group("/:id")
 		unleashInstance.Use(h.UnleashInstanceMiddleware)
 		{
 			unleashInstance.GET("/", h.UnleashInstanceShow)
+			unleashInstance.GET("/runtime-config", h.UnleashInstanceRuntimeConfig)
+			unleashInstance.GET("/checksum", h.UnleashInstanceChecksum)
+			unleashInstance.GET("/status", h.UnleashInstanceStatus)
+			unleashInstance.GET("/egress", h.UnleashInstanceEgress)
+			unleashInstance.GET("/connection", h.UnleashInstanceConnection)
+			unleashInstance.GET("/manifest", h.UnleashInstanceManifest)
+			unleashInstance.POST("/repair-secret", h.UnleashInstanceRepairSecretPost)
+			unleashInstance.POST("/rotate-credentials", h.UnleashInstanceRotateCredentialsPost)
+			unleashInstance.POST("/clone", h.UnleashInstanceClonePost)
 			unleashInstance.GET("/edit", h.UnleashInstanceEdit)
 			unleashInstance.POST("/edit", h.UnleashInstancePost)
 			unleashInstance.GET("/delete", h.UnleashInstanceDelete)
@@ -115,25 +175,108 @@ func setupRouter(config *config.Config, logger *logrus.Logger, unleashService un
 	return router
 }
 
-func Run(config *config.Config) {
+func Run(config *config.Config) error {
 	logger := initLogger()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, config)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.WithError(err).Warn("Error flushing traces")
+		}
+	}()
+
 	kubeClient, err := initKubernetesClient()
 	if err != nil {
 		logger.Fatal(err)
 	}
+	kubeClient = tracing.NewKubeClient(kubeClient)
+
+	if err := unleash.EnsureInstanceNamespace(ctx, kubeClient, config.Unleash.InstanceNamespace, config.Unleash.InstanceNamespaceCreate); err != nil {
+		if !errors.Is(err, unleash.ErrInstanceNamespaceUnverified) {
+			logger.Fatal(err)
+		}
+		logger.WithError(err).Warn("Not allowed to get the instance namespace, assuming it exists")
+	}
+
+	if err := unleash.CheckTeamsApiSecret(ctx, kubeClient, config.Unleash.InstanceNamespace, config.Unleash.TeamsApiSecretName, config.Unleash.TeamsApiSecretTokenKey); err != nil {
+		if config.Unleash.TeamsApiSecretRequired {
+			logger.Fatal(err)
+		}
+		logger.WithError(err).Warn("Unleash instances will not be able to authenticate to the teams API")
+	}
 
-	_, sqlDatabasesClient, sqlUsersClient, err := initGoogleClients(context.Background())
+	_, sqlDatabasesClient, sqlUsersClient, err := initGoogleClients(ctx)
 	if err != nil {
 		logger.Fatal(err)
 	}
 
-	unleashService := unleash.NewUnleashService(sqlDatabasesClient, sqlUsersClient, kubeClient, config, logger)
+	service := unleash.NewUnleashService(sqlDatabasesClient, sqlUsersClient, kubeClient, config, logger)
+	unleashService := unleash.NewTracedUnleashService(service)
+
+	go refreshInstanceMetrics(ctx, unleashService, logger, instanceMetricsInterval)
+
+	if config.Unleash.ReaperEnabled {
+		reaper := unleash.NewReaper(kubeClient, config, logger)
+		go reaper.Run(ctx, time.Duration(config.Unleash.ReaperIntervalMinutes)*time.Minute)
+	}
 
 	router := setupRouter(config, logger, unleashService)
 
+	// Only reading the request headers is bounded, a full read or write timeout would cut off deletes and creates
+	// that wait for drains and Cloud SQL retries. Use BIFROST_REQUEST_TIMEOUT to bound those.
+	srv := &http.Server{
+		Addr:              config.GetServerAddr(),
+		Handler:           router,
+		ReadHeaderTimeout: time.Duration(config.Server.ReadTimeout) * time.Second,
+		IdleTimeout:       time.Duration(config.Server.IdleTimeout) * time.Second,
+	}
+
+	grace := time.Duration(config.Server.GracefulTimeout) * time.Second
+
 	logger.Infof("Listening on %s", config.GetServerAddr())
-	if err := router.Run(config.GetServerAddr()); err != nil {
-		logger.Fatal(err)
+	err = serve(ctx, srv, logger, grace)
+
+	// Events are published by requests, so the queue is drained once the server has stopped serving them
+	closeCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if closeErr := service.Close(closeCtx); closeErr != nil {
+		logger.WithError(closeErr).Warn("Error publishing queued events")
+	}
+
+	return err
+}
+
+// serve runs srv until ctx is cancelled and then waits up to grace for in-flight requests to finish.
+func serve(ctx context.Context, srv *http.Server, logger *logrus.Logger, grace time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
 	}
+
+	logger.Infof("Shutting down, waiting up to %s for in-flight requests", grace)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("graceful shutdown failed: %w", err)
+	}
+
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
 }
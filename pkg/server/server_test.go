@@ -1,9 +1,13 @@
 package server
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -12,34 +16,68 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/handler"
 	"github.com/nais/bifrost/pkg/unleash"
 	unleashv1 "github.com/nais/unleasherator/api/v1"
 	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
 )
 
 type MockUnleashService struct {
-	c         *config.Config
-	Instances []*unleash.UnleashInstance
+	c              *config.Config
+	Instances      []*unleash.UnleashInstance
+	MissingSecrets map[string]bool
+	ListErr        error
+	ListDelay      time.Duration
+	GetErrs        map[string]error
+
+	LastDeleteOptions unleash.DeleteOptions
+	Archived          []*unleash.UnleashInstance
+	MissingUsers      map[string]bool
+	Rotations         map[string]bool
+	Replicas          map[string]int32
 }
 
 func (s *MockUnleashService) List(ctx context.Context) ([]*unleash.UnleashInstance, error) {
+	if s.ListDelay > 0 {
+		select {
+		case <-time.After(s.ListDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if s.ListErr != nil {
+		return nil, s.ListErr
+	}
 	return s.Instances, nil
 }
 
 func (s *MockUnleashService) Get(ctx context.Context, name string) (*unleash.UnleashInstance, error) {
+	if err := s.GetErrs[name]; err != nil {
+		return nil, err
+	}
+
 	for _, instance := range s.Instances {
 		if instance.Name == name {
 			return instance, nil
 		}
 	}
 
-	return nil, fmt.Errorf("instance not found")
+	return nil, apierrors.NewNotFound(unleashv1.GroupVersion.WithResource("unleashes").GroupResource(), name)
 }
 
 func (s *MockUnleashService) Create(ctx context.Context, uc *unleash.UnleashConfig) (*unleashv1.Unleash, error) {
+	for _, instance := range s.Archived {
+		if instance.Name == uc.Name {
+			return nil, fmt.Errorf("%w: %s", unleash.ErrInstanceArchived, uc.Name)
+		}
+	}
+
 	spec := unleash.UnleashDefinition(s.c, uc)
 
 	s.Instances = append(s.Instances, &unleash.UnleashInstance{
@@ -64,7 +102,9 @@ func (s *MockUnleashService) Update(ctx context.Context, uc *unleash.UnleashConf
 	return nil, fmt.Errorf("instance not found")
 }
 
-func (s *MockUnleashService) Delete(ctx context.Context, name string) error {
+func (s *MockUnleashService) Delete(ctx context.Context, name string, opts unleash.DeleteOptions) error {
+	s.LastDeleteOptions = opts
+
 	for i, instance := range s.Instances {
 		if instance.Name == name {
 			s.Instances = append(s.Instances[:i], s.Instances[i+1:]...)
@@ -75,6 +115,64 @@ func (s *MockUnleashService) Delete(ctx context.Context, name string) error {
 	return fmt.Errorf("instance not found")
 }
 
+func (s *MockUnleashService) DatabaseSecretExists(ctx context.Context, name string) (bool, error) {
+	return !s.MissingSecrets[name], nil
+}
+
+func (s *MockUnleashService) RepairDatabaseSecret(ctx context.Context, name string) error {
+	if !s.MissingSecrets[name] {
+		return unleash.ErrDatabaseSecretExists
+	}
+
+	delete(s.MissingSecrets, name)
+	return nil
+}
+
+func (s *MockUnleashService) ReadyReplicas(ctx context.Context, name string) (int32, error) {
+	return s.Replicas[name], nil
+}
+
+func (s *MockUnleashService) RotateCredentials(ctx context.Context, name string, restart bool) error {
+	if s.MissingUsers[name] {
+		return unleash.ErrDatabaseUserNotFound
+	}
+
+	if s.Rotations == nil {
+		s.Rotations = map[string]bool{}
+	}
+	s.Rotations[name] = restart
+	return nil
+}
+
+func (s *MockUnleashService) ListArchived(ctx context.Context) ([]*unleash.UnleashInstance, error) {
+	return s.Archived, nil
+}
+
+func (s *MockUnleashService) Restore(ctx context.Context, name string) (*unleashv1.Unleash, error) {
+	for i, instance := range s.Archived {
+		if instance.Name == name {
+			s.Archived = append(s.Archived[:i], s.Archived[i+1:]...)
+			instance.Archived = false
+			s.Instances = append(s.Instances, instance)
+			return instance.ServerInstance, nil
+		}
+	}
+
+	return nil, unleash.ErrInstanceNotArchived
+}
+
+func (s *MockUnleashService) Egress(ctx context.Context, name string) (*unleash.EgressSummary, error) {
+	instance, err := s.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	uc := unleash.UnleashVariables(instance.ServerInstance, false)
+	fqdn := unleash.FQDNNetworkPolicyDefinition(name, s.c.Unleash.InstanceNamespace, nil, unleash.PolicyEgressFQDNs(s.c, uc))
+
+	return unleash.NewEgressSummary(s.c, instance.ServerInstance, &fqdn), nil
+}
+
 func unleashConfigToForm(uc *unleash.UnleashConfig) string {
 	enableFederation := ""
 	if uc.EnableFederation {
@@ -107,9 +205,37 @@ func TestHealthzRoute(t *testing.T) {
 	assert.Equal(t, "OK", w.Body.String())
 }
 
-func TestMetricsRoute(t *testing.T) {
-	t.Skip()
+func TestReadyzRoute(t *testing.T) {
+	config := &config.Config{}
+	service := &MockUnleashService{c: config}
+	logger, hook := test.NewNullLogger()
+	router := setupRouter(config, logger, service)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+
+	service.ListErr = fmt.Errorf("connection refused")
 
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/readyz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 503, w.Code)
+	assert.JSONEq(t, `{"status":"unavailable","dependency":"kubernetes"}`, w.Body.String())
+	if assert.NotNil(t, hook.LastEntry()) {
+		assert.Equal(t, "Readiness check failed", hook.LastEntry().Message)
+		assert.EqualError(t, hook.LastEntry().Data[logrus.ErrorKey].(error), "connection refused")
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/healthz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestMetricsRoute(t *testing.T) {
 	config := &config.Config{}
 	logger := logrus.New()
 	service := &MockUnleashService{c: config}
@@ -121,6 +247,32 @@ func TestMetricsRoute(t *testing.T) {
 
 	assert.Equal(t, 200, w.Code)
 	assert.Contains(t, w.Body.String(), "go_gc_duration_seconds")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/healthz", nil)
+	router.ServeHTTP(w, req)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), `bifrost_http_request_duration_seconds_count{code="200",method="GET",route="/healthz"}`)
+	assert.Contains(t, w.Body.String(), `bifrost_http_request_duration_seconds_count{code="200",method="GET",route="/metrics"}`)
+}
+
+func TestRefreshInstanceMetrics(t *testing.T) {
+	_, service, _ := newUnleashRoute()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	refreshInstanceMetrics(ctx, service, logrus.New(), time.Hour)
+
+	config := &config.Config{}
+	router := setupRouter(config, logrus.New(), service)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), `bifrost_unleash_instances{version="1.2.3"} 1`)
+	assert.Contains(t, w.Body.String(), `bifrost_unleash_instances{version="4.5.6"} 1`)
 }
 
 func newUnleashRoute() (c *config.Config, service *MockUnleashService, router *gin.Engine) {
@@ -128,6 +280,11 @@ func newUnleashRoute() (c *config.Config, service *MockUnleashService, router *g
 		Server: config.ServerConfig{
 			TemplatesDir: "../../templates",
 		},
+		Unleash: config.UnleashConfig{
+			DatabasePoolIdleTimeoutMinMs: 100,
+			DatabasePoolIdleTimeoutMaxMs: 60000,
+		},
+		CloudConnectorProxy: "repo/connector:latest",
 	}
 
 	unleash1 := unleash.UnleashDefinition(c, &unleash.UnleashConfig{
@@ -385,4 +542,1101 @@ func TestUnleashDelete(t *testing.T) {
 	assert.Equal(t, 302, w.Code)
 	assert.Equal(t, "/unleash", w.Header().Get("Location"))
 	assert.Equal(t, 1, len(service.Instances))
+	assert.False(t, service.LastDeleteOptions.OrphanDatabase)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/unleash/team-b/delete", strings.NewReader("name=team-b&orphan-database=true"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 302, w.Code)
+	assert.Equal(t, 0, len(service.Instances))
+	assert.True(t, service.LastDeleteOptions.OrphanDatabase)
+}
+
+func TestUnleashNewPrettyJSON(t *testing.T) {
+	_, _, router := newUnleashRoute()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/unleash/new?pretty=true", strings.NewReader(`{"name": "my-name"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "{\n    \"kind\": \"Unleash\",\n    \"apiVersion\": \"unleash.nais.io/v1\",")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/unleash/new", strings.NewReader(`{"name": "my-other-name"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `{"kind":"Unleash","apiVersion":"unleash.nais.io/v1",`)
+}
+
+func TestUnleashRuntimeConfig(t *testing.T) {
+	_, _, router := newUnleashRoute()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/team-a/runtime-config", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"log-level":"debug","database-pool-max":10,"database-pool-idle-timeout-ms":100,"sql-proxy-image":"repo/connector:latest","managed-env-vars":["GOOGLE_IAP_AUDIENCE","TEAMS_API_URL","TEAMS_API_TOKEN","TEAMS_ALLOWED_TEAMS","LOG_LEVEL","DATABASE_POOL_MAX","DATABASE_POOL_IDLE_TIMEOUT_MS"],"extra-env-vars":[]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-b/runtime-config", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"log-level":"warn","database-pool-max":3,"database-pool-idle-timeout-ms":1000,"sql-proxy-image":"repo/connector:latest","managed-env-vars":["GOOGLE_IAP_AUDIENCE","TEAMS_API_URL","TEAMS_API_TOKEN","TEAMS_ALLOWED_TEAMS","LOG_LEVEL","DATABASE_POOL_MAX","DATABASE_POOL_IDLE_TIMEOUT_MS"],"extra-env-vars":[]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/does-not-exist/runtime-config", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 301, w.Code)
+}
+
+func TestUnleashAdmissionPolicy(t *testing.T) {
+	c, service, _ := newUnleashRoute()
+
+	opa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input struct {
+				Instance unleash.UnleashConfig `json:"instance"`
+			} `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		allow := body.Input.Instance.LogLevel != "debug"
+		_ = json.NewEncoder(w).Encode(gin.H{"result": gin.H{"allow": allow, "reason": "debug logging is not allowed"}})
+	}))
+	defer opa.Close()
+
+	c.Unleash.AdmissionPolicyURL = opa.URL
+	router := setupRouter(c, logrus.New(), service)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/unleash/new", strings.NewReader(`{"name": "my-name", "log-level": "debug"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 403, w.Code)
+	assert.JSONEq(t, `{"error":"Rejected by admission policy","reason":"debug logging is not allowed"}`, w.Body.String())
+	assert.Equal(t, 2, len(service.Instances))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/unleash/new", strings.NewReader(`{"name": "my-name", "log-level": "info"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 3, len(service.Instances))
+}
+
+func TestInstancesHealth(t *testing.T) {
+	_, service, router := newUnleashRoute()
+
+	service.Instances[0].ServerInstance.Status.Conditions = []metav1.Condition{
+		{Type: unleashv1.UnleashStatusConditionTypeReconciled, Status: metav1.ConditionTrue},
+		{Type: unleashv1.UnleashStatusConditionTypeConnected, Status: metav1.ConditionTrue},
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz/instances", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"ready":false,"instances":2,"ready-instances":1,"not-ready-instances":1}`, w.Body.String())
+
+	service.Instances = service.Instances[:1]
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/healthz/instances", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"ready":true,"instances":1,"ready-instances":1,"not-ready-instances":0}`, w.Body.String())
+}
+
+func TestUnleashChecksum(t *testing.T) {
+	_, service, router := newUnleashRoute()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/team-a/checksum", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var checksum unleash.UnleashConfigChecksum
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &checksum))
+	assert.Equal(t, service.Instances[0].ServerInstance.GetAnnotations()[unleash.ConfigChecksumAnnotationKey], checksum.Checksum)
+	assert.False(t, checksum.Drift)
+}
+
+func TestUnleashStatusSecretMissing(t *testing.T) {
+	c, service, router := newUnleashRoute()
+	service.MissingSecrets = map[string]bool{"team-b": true}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/team-a/status", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"name":"team-a","status":"Not ready","ready":false,"version":"1.2.3","secret-missing":false,"desired-replicas":1,"ready-replicas":0,"replica-mismatch":true}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-b/status", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"name":"team-b","status":"Not ready","ready":false,"version":"4.5.6","secret-missing":true,"desired-replicas":1,"ready-replicas":0,"replica-mismatch":true}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/unleash/team-b/repair-secret", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 403, w.Code)
+	assert.True(t, service.MissingSecrets["team-b"])
+
+	c.Unleash.SecretRepairEnabled = true
+	router = setupRouter(c, logrus.New(), service)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/unleash/team-b/repair-secret", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.False(t, service.MissingSecrets["team-b"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/unleash/team-b/repair-secret", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 409, w.Code)
+}
+
+func TestUnleashIndexPagination(t *testing.T) {
+	_, _, router := newUnleashRoute()
+
+	list := func(query string) (*httptest.ResponseRecorder, []unleashv1.Unleash) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/unleash/"+query, nil)
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		var servers []unleashv1.Unleash
+		_ = json.Unmarshal(w.Body.Bytes(), &servers)
+		return w, servers
+	}
+
+	w, servers := list("")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+	assert.Len(t, servers, 2)
+
+	w, servers = list("?name_prefix=team-b")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+	assert.Len(t, servers, 1)
+	assert.Equal(t, "team-b", servers[0].Name)
+
+	w, servers = list("?limit=1&offset=1")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+	assert.Len(t, servers, 1)
+	assert.Equal(t, "team-b", servers[0].Name)
+
+	w, _ = list("?offset=10")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, "[]", w.Body.String())
+
+	w, _ = list("?limit=-1")
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	var body map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.NotEmpty(t, body["error"])
+
+	w, _ = list("?archived=maybe")
+	assert.Equal(t, 400, w.Code)
+	assert.JSONEq(t, `{"error":"invalid archived \"maybe\", expected true, false or only"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/?limit=-1", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/?name_prefix=team-a", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "<a class=\"header\" href=\"team-a\">team-a</a>")
+	assert.NotContains(t, w.Body.String(), "<a class=\"header\" href=\"team-b\">team-b</a>")
+}
+
+func TestUnleashEditVersionChangeNotReady(t *testing.T) {
+	c, service, _ := newUnleashRoute()
+	c.Unleash.BlockVersionChangeWhenNotReady = true
+	router := setupRouter(c, logrus.New(), service)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/unleash/team-a/edit", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(`{"custom-version": "v5.10.2-20240329-070801-0180a96"}`)
+	assert.Equal(t, 409, w.Code)
+	assert.Contains(t, w.Body.String(), `"error":"instance_not_ready"`)
+
+	w = post(`{"log-level": "info"}`)
+	assert.Equal(t, 200, w.Code)
+
+	service.Instances[0].ServerInstance.Status.Conditions = []metav1.Condition{
+		{Type: unleashv1.UnleashStatusConditionTypeReconciled, Status: metav1.ConditionTrue},
+		{Type: unleashv1.UnleashStatusConditionTypeConnected, Status: metav1.ConditionTrue},
+	}
+
+	w = post(`{"custom-version": "v5.10.2-20240329-070801-0180a96"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "unleash-v4:v5.10.2-20240329-070801-0180a96")
+}
+
+func TestUnleashArchiveAndRestore(t *testing.T) {
+	c, service, router := newUnleashRoute()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/unleash/team-b/delete?soft=true", strings.NewReader("name=team-b"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 302, w.Code)
+	assert.True(t, service.LastDeleteOptions.Archive)
+
+	archived := unleash.UnleashDefinition(c, &unleash.UnleashConfig{Name: "team-c"})
+	service.Archived = []*unleash.UnleashInstance{{Name: "team-c", ServerInstance: &archived, Archived: true}}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/", nil)
+	router.ServeHTTP(w, req)
+	assert.NotContains(t, w.Body.String(), "team-c")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/?archived=true", nil)
+	router.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), "<a class=\"header\" href=\"team-c\">team-c</a>")
+	assert.Contains(t, w.Body.String(), "<div class=\"ui grey label\">Archived</div>")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/?archived=only", nil)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var listed []map[string]any
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	if assert.Len(t, listed, 1) {
+		assert.Equal(t, "team-c", listed[0]["metadata"].(map[string]any)["name"])
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/?archived=maybe", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/unleash/new", strings.NewReader(`{"name": "team-c"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 409, w.Code)
+	assert.JSONEq(t, `{"error":"instance_archived","reason":"Instance team-c is archived, restore it instead"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/unleash/team-c/restore", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 302, w.Code)
+	assert.Equal(t, "/unleash/team-c/", w.Header().Get("Location"))
+	assert.Empty(t, service.Archived)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/unleash/team-c/restore", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestUnleashEgress(t *testing.T) {
+	c, service, router := newUnleashRoute()
+	c.Unleash.SQLInstanceAddress = "1.2.3.4"
+	c.Unleash.ExtraEgressFQDNs = "logs.example.com,hooks.slack.com"
+	_, err := service.Create(context.Background(), &unleash.UnleashConfig{Name: "team-c", AllowedEgressFQDNs: "hooks.example.com,logs.example.com"})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/team-c/egress", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{
+		"allow-dns": true,
+		"rules": [
+			{"type": "cidr", "destinations": ["1.2.3.4/32"], "ports": ["TCP/3307"]},
+			{
+				"type": "fqdn",
+				"destinations": ["sqladmin.googleapis.com", "www.gstatic.com", "hooks.slack.com", "console.nav.cloud.nais.io", "logs.example.com", "hooks.example.com"],
+				"ports": ["TCP/443"],
+				"sources": {
+					"sqladmin.googleapis.com": "default",
+					"www.gstatic.com": "default",
+					"hooks.slack.com": "default",
+					"console.nav.cloud.nais.io": "default",
+					"logs.example.com": "global",
+					"hooks.example.com": "instance"
+				}
+			},
+			{"type": "fqdn", "destinations": ["metadata.google.internal"], "ports": ["TCP/80", "TCP/988"], "sources": {"metadata.google.internal": "default"}}
+		]
+	}`, w.Body.String())
+}
+
+func TestUnleashNewDatabasePoolIdleTimeoutBounds(t *testing.T) {
+	_, service, router := newUnleashRoute()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/unleash/new", strings.NewReader(`{"name": "my-name", "database-pool-idle-timeout-ms": 60001}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid database pool idle timeout: 60001 ms is outside the allowed range 100-60000 ms")
+	assert.Equal(t, 2, len(service.Instances))
+}
+
+func TestUnleashNewValidationDetails(t *testing.T) {
+	_, service, router := newUnleashRoute()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/unleash/new", strings.NewReader(`{"name": "my-name", "log-level": "loud", "database-pool-idle-timeout-ms": 60001, "memory-limit": "lots"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, 2, len(service.Instances))
+
+	var body struct {
+		Details map[string]string `json:"details"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Len(t, body.Details, 3)
+	assert.Contains(t, body.Details, "log-level")
+	assert.Contains(t, body.Details, "database-pool-idle-timeout-ms")
+	assert.Contains(t, body.Details, "memory-limit")
+}
+
+func TestUnleashConnection(t *testing.T) {
+	c, service, router := newUnleashRoute()
+	c.Unleash.InstanceAPIIngressHost = "unleash-api.example.com"
+	c.Unleash.InstanceWebIngressHost = "unleash-web.example.com"
+	c.Unleash.SQLInstanceAddress = "1.2.3.4"
+	_, err := service.Create(context.Background(), &unleash.UnleashConfig{Name: "team-c"})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/team-c/connection", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{
+		"name": "team-c",
+		"api-url": "https://team-c-unleash-api.example.com/api/",
+		"web-url": "https://team-c-unleash-web.example.com/",
+		"secret-name": "team-c",
+		"sql-instance-address": "1.2.3.4"
+	}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/does-not-exist/connection", nil)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+	assert.JSONEq(t, `{"error":"Instance not found"}`, w.Body.String())
+}
+
+func TestUnleashShowDetailFull(t *testing.T) {
+	_, _, router := newUnleashRoute()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/team-a/?detail=full", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var detail map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+	for _, key := range []string{"name", "spec", "status", "image", "federation", "egress", "runtime-config"} {
+		assert.Contains(t, detail, key)
+	}
+	assert.JSONEq(t, `"team-a"`, string(detail["name"]))
+	assert.JSONEq(t, `"europe-north1-docker.pkg.dev/nais-io/nais/images/unleash-v4:v1.2.3-00000000-000000-abcd1234"`, string(detail["image"]))
+	assert.Contains(t, string(detail["status"]), `"version":"1.2.3"`)
+	assert.Contains(t, string(detail["federation"]), `"enabled":true`)
+	assert.Contains(t, string(detail["egress"]), `"rules":[`)
+	assert.Contains(t, string(detail["runtime-config"]), `"log-level":"debug"`)
+}
+
+func TestUnleashIndexGzip(t *testing.T) {
+	c, service, _ := newUnleashRoute()
+	c.Server.GzipEnabled = true
+	c.Server.GzipMinSize = 1024
+	router := setupRouter(c, logrus.New(), service)
+
+	for i := 0; i < 50; i++ {
+		_, err := service.Create(context.Background(), &unleash.UnleashConfig{Name: fmt.Sprintf("instance-%d", i)})
+		assert.NoError(t, err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/", nil)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+
+	gz, err := gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	body, err := io.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"instance-49"`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/", nil)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Contains(t, w.Body.String(), `"instance-49"`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-a/status", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Contains(t, w.Body.String(), `"name":"team-a"`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/", nil)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip;q=0, identity")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Contains(t, w.Body.String(), `"instance-49"`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("HEAD", "/healthz", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+}
+
+func TestUnleashShowDetailETagGzip(t *testing.T) {
+	c, service, _ := newUnleashRoute()
+	c.Server.GzipEnabled = true
+	router := setupRouter(c, logrus.New(), service)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/team-a/?detail=full", nil)
+	router.ServeHTTP(w, req)
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-a/?detail=full", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", etag)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 304, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Empty(t, w.Body.Bytes())
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                     false,
+		"gzip":                 true,
+		"GZIP":                 true,
+		"deflate, gzip":        true,
+		"gzip;q=0.5":           true,
+		"gzip;q=0":             false,
+		"gzip; q=0.0, br":      false,
+		"*":                    true,
+		"*;q=0":                false,
+		"*, gzip;q=0":          false,
+		"gzip, *;q=0":          true,
+		"identity":             false,
+		"gzip;q=invalid, br":   false,
+		"x-gzip":               true,
+		"deflate;q=1, br;q=.8": false,
+	} {
+		assert.Equal(t, want, acceptsGzip(header), header)
+	}
+}
+
+func TestUnleashShowDetailETag(t *testing.T) {
+	_, service, router := newUnleashRoute()
+
+	get := func(etag string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/unleash/team-a/?detail=full", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	assert.Equal(t, 200, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, etag, get("").Header().Get("ETag"))
+
+	w = get(etag)
+	assert.Equal(t, 304, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	assert.Equal(t, 304, get(`"other", W/`+etag).Code)
+	assert.Equal(t, 304, get("*").Code)
+	assert.Equal(t, 200, get(`"other", W/"another"`).Code)
+
+	_, err := service.Update(context.Background(), &unleash.UnleashConfig{Name: "team-a", LogLevel: "warn"})
+	assert.NoError(t, err)
+
+	w = get(etag)
+	assert.Equal(t, 200, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"log-level":"warn"`)
+}
+
+func TestUnleashNewIngressHostLength(t *testing.T) {
+	c, service, router := newUnleashRoute()
+	c.Unleash.InstanceWebIngressHost = "unleash-web.example.com"
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/unleash/new", strings.NewReader(fmt.Sprintf(`{"name": "%s"}`, strings.Repeat("a", 52))))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "has a first label of 64 characters, exceeding the limit of 63")
+	assert.Equal(t, 2, len(service.Instances))
+}
+
+func TestUnleashRotateCredentials(t *testing.T) {
+	_, service, router := newUnleashRoute()
+	service.MissingUsers = map[string]bool{"team-b": true}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/unleash/team-a/rotate-credentials", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"status":"rotated","restarted":false}`, w.Body.String())
+	assert.Equal(t, map[string]bool{"team-a": false}, service.Rotations)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/unleash/team-a/rotate-credentials?restart=true", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"status":"rotated","restarted":true}`, w.Body.String())
+	assert.Equal(t, map[string]bool{"team-a": true}, service.Rotations)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/unleash/team-b/rotate-credentials", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+	assert.JSONEq(t, `{"error":"Database user not found"}`, w.Body.String())
+}
+
+func TestUnleashIndexReady(t *testing.T) {
+	_, service, router := newUnleashRoute()
+
+	service.Instances[0].ServerInstance.Status.Conditions = []metav1.Condition{
+		{Type: unleashv1.UnleashStatusConditionTypeReconciled, Status: metav1.ConditionTrue},
+		{Type: unleashv1.UnleashStatusConditionTypeConnected, Status: metav1.ConditionTrue},
+	}
+
+	list := func(query string) (*httptest.ResponseRecorder, []map[string]any) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/unleash/"+query, nil)
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		var servers []map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &servers)
+		return w, servers
+	}
+
+	w, servers := list("")
+	assert.Equal(t, 200, w.Code)
+	assert.Len(t, servers, 2)
+	assert.Equal(t, true, servers[0]["ready"])
+	assert.Equal(t, false, servers[1]["ready"])
+	assert.Equal(t, "team-a", servers[0]["metadata"].(map[string]any)["name"])
+	assert.Equal(t, "Unleash", servers[0]["kind"])
+
+	w, servers = list("?ready=false")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+	assert.Len(t, servers, 1)
+	assert.Equal(t, "team-b", servers[0]["metadata"].(map[string]any)["name"])
+
+	w, servers = list("?ready=true")
+	assert.Equal(t, 200, w.Code)
+	assert.Len(t, servers, 1)
+	assert.Equal(t, "team-a", servers[0]["metadata"].(map[string]any)["name"])
+
+	w, _ = list("?ready=maybe")
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestUnleashNewStrictJSON(t *testing.T) {
+	c, service, router := newUnleashRoute()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/unleash/new", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(`{"name": "lenient", "colour": "blue"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 3, len(service.Instances))
+
+	c.Server.StrictJSON = true
+
+	w = post(`{"name": "strict", "colour": "blue"}`)
+	assert.Equal(t, 400, w.Code)
+	assert.JSONEq(t, `{"error":"unknown_field","field":"colour","reason":"Unknown field \"colour\""}`, w.Body.String())
+	assert.Equal(t, 3, len(service.Instances))
+
+	w = post(`{"name": "strict", "log-level": "info", "labels": {"cost-center": "1234"}}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 4, len(service.Instances))
+	assert.Equal(t, "strict", service.Instances[3].Name)
+}
+
+func TestUnleashClone(t *testing.T) {
+	_, service, router := newUnleashRoute()
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/unleash/team-a/clone", `{"name": "team-c"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 3, len(service.Instances))
+
+	source := service.Instances[0].ServerInstance
+	clone := service.Instances[2].ServerInstance
+	assert.Equal(t, "team-c", clone.Name)
+	assert.Equal(t, source.Spec.CustomImage, clone.Spec.CustomImage)
+	assert.Equal(t, source.Spec.Federation.Clusters, clone.Spec.Federation.Clusters)
+	assert.Equal(t, source.Spec.Federation.Namespaces, clone.Spec.Federation.Namespaces)
+	assert.Contains(t, clone.Spec.ExtraEnvVars, v1.EnvVar{Name: "LOG_LEVEL", Value: "debug"})
+	assert.NotEqual(t, source.Spec.Federation.SecretNonce, clone.Spec.Federation.SecretNonce)
+
+	w = post("/unleash/team-a/clone", `{"name": "team-d", "copy-federation-nonce": true}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, source.Spec.Federation.SecretNonce, service.Instances[3].ServerInstance.Spec.Federation.SecretNonce)
+
+	w = post("/unleash/team-a/clone", `{"name": "team-b"}`)
+	assert.Equal(t, 409, w.Code)
+	assert.Contains(t, w.Body.String(), `"error":"instance_exists"`)
+
+	w = post("/unleash/team-a/clone", `{"name": "Not A Hostname"}`)
+	assert.Equal(t, 400, w.Code)
+
+	w = post("/unleash/does-not-exist/clone", `{"name": "team-e"}`)
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, 4, len(service.Instances))
+}
+
+func TestUnleashCloneTargetLookupError(t *testing.T) {
+	_, service, router := newUnleashRoute()
+	service.GetErrs = map[string]error{"team-c": fmt.Errorf("connection refused")}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/unleash/team-a/clone", strings.NewReader(`{"name": "team-c"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 500, w.Code)
+	assert.JSONEq(t, `{"error":"Error checking if instance exists"}`, w.Body.String())
+	assert.Equal(t, 2, len(service.Instances))
+}
+
+func TestUnleashCloneWeakFederationNonce(t *testing.T) {
+	c, service, router := newUnleashRoute()
+	c.Unleash.FederationNonceMinLength = 8
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/unleash/team-a/clone", strings.NewReader(`{"name": "team-c", "copy-federation-nonce": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), `"error":"weak_federation_nonce"`)
+	assert.Equal(t, 2, len(service.Instances))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/unleash/team-a/clone", strings.NewReader(`{"name": "team-c"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Len(t, service.Instances[2].ServerInstance.Spec.Federation.SecretNonce, 8)
+}
+
+func TestServeGracefulShutdown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	assert.NoError(t, listener.Close())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			_, _ = w.Write([]byte("done"))
+		}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- serve(ctx, srv, logrus.New(), 5*time.Second)
+	}()
+
+	var resp *http.Response
+	var reqErr error
+	reqDone := make(chan struct{})
+	go func() {
+		defer close(reqDone)
+		for i := 0; i < 50; i++ {
+			resp, reqErr = http.Get("http://" + addr)
+			if reqErr == nil {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	<-started
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	<-reqDone
+	assert.NoError(t, reqErr)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "done", string(body))
+
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after the context was cancelled")
+	}
+}
+
+func TestUnleashStatusReplicas(t *testing.T) {
+	_, service, router := newUnleashRoute()
+	service.Replicas = map[string]int32{"team-a": 1}
+
+	status := func(name string) map[string]any {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/unleash/"+name+"/status", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code)
+
+		var body map[string]any
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body
+	}
+
+	body := status("team-a")
+	assert.Equal(t, float64(1), body["desired-replicas"])
+	assert.Equal(t, float64(1), body["ready-replicas"])
+	assert.Equal(t, false, body["replica-mismatch"])
+
+	body = status("team-b")
+	assert.Equal(t, float64(1), body["desired-replicas"])
+	assert.Equal(t, float64(0), body["ready-replicas"])
+	assert.Equal(t, true, body["replica-mismatch"])
+}
+
+func TestUnleashIndexRequestTimeout(t *testing.T) {
+	c, service, _ := newUnleashRoute()
+	c.Server.RequestTimeout = 1
+	service.ListDelay = time.Minute
+	router := setupRouter(c, logrus.New(), service)
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/", nil)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.Equal(t, 504, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error":"Request timed out"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/", nil)
+	req.Header.Set("Accept", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 504, w.Code)
+	assert.JSONEq(t, `{"error":"Request timed out"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/", nil)
+	req.Header.Set("Accept", "text/html")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 504, w.Code)
+	assert.Equal(t, "Request timed out", w.Body.String())
+
+	service.ListDelay = 0
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/", nil)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestUnleashInstanceManifest(t *testing.T) {
+	_, service, router := newUnleashRoute()
+	source := service.Instances[0].ServerInstance
+	source.ResourceVersion = "12345"
+	source.UID = "0000-1111"
+	source.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "unleasherator"}}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/team-a/manifest", nil)
+	req.Header.Set("Accept", "application/yaml")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/yaml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.NotContains(t, w.Body.String(), "resourceVersion")
+	assert.NotContains(t, w.Body.String(), "managedFields")
+
+	manifest := unleashv1.Unleash{}
+	assert.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &manifest))
+	assert.Equal(t, "Unleash", manifest.Kind)
+	assert.Equal(t, "unleash.nais.io/v1", manifest.APIVersion)
+	assert.Equal(t, source.Name, manifest.Name)
+	assert.Equal(t, source.Annotations, manifest.Annotations)
+	assert.Empty(t, manifest.UID)
+	assert.Equal(t, source.Spec, manifest.Spec)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unleash/team-a/manifest", nil)
+	req.Header.Set("Accept", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	manifest = unleashv1.Unleash{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &manifest))
+	assert.Equal(t, source.Spec, manifest.Spec)
+	assert.Empty(t, manifest.ResourceVersion)
+}
+
+func TestUnleashRateLimit(t *testing.T) {
+	c, service, _ := newUnleashRoute()
+	c.Server.RateLimits = "POST:1:2"
+	router := setupRouter(c, logrus.New(), service)
+
+	post := func(name, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/unleash/new", strings.NewReader(fmt.Sprintf(`{"name": %q}`, name)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Goog-Authenticated-User-Email", user)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, 200, post("team-c", "alice@example.com").Code)
+	assert.Equal(t, 200, post("team-d", "alice@example.com").Code)
+
+	w := post("team-e", "alice@example.com")
+	assert.Equal(t, 429, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error":"Too many requests"}`, w.Body.String())
+	assert.Equal(t, 4, len(service.Instances))
+
+	// Without a verified IAP assertion the user header is not trusted and both users share the client IP
+	assert.Equal(t, 429, post("team-e", "bob@example.com").Code)
+
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/unleash/", nil)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Goog-Authenticated-User-Email", "alice@example.com")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code)
+	}
+}
+
+func TestRateLimitIAPCaller(t *testing.T) {
+	verify := func(ctx context.Context, token string) (string, error) {
+		if token == "valid-alice" {
+			return "alice@example.com", nil
+		}
+		return "", errors.New("invalid token")
+	}
+
+	router := gin.New()
+	router.Use(rateLimitMiddleware(map[string]config.RateLimit{"POST": {PerMinute: 1, Burst: 1}}, verify))
+	router.POST("/", func(c *gin.Context) { c.String(200, "ok") })
+
+	post := func(token string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", nil)
+		req.Header.Set("X-Goog-IAP-JWT-Assertion", token)
+		req.Header.Set("X-Goog-Authenticated-User-Email", "mallory@example.com")
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, 200, post("valid-alice"))
+	assert.Equal(t, 429, post("valid-alice"))
+
+	// Invalid assertions fall back to the client IP, which has its own limiter
+	assert.Equal(t, 200, post("forged"))
+	assert.Equal(t, 429, post(""))
+}
+
+func TestRateLimiterEvictsIdle(t *testing.T) {
+	now := time.Now()
+	l := &rateLimiter{
+		limits:   map[string]config.RateLimit{"POST": {PerMinute: 2, Burst: 2}},
+		now:      func() time.Time { return now },
+		limiters: map[string]*callerLimiter{},
+	}
+
+	l.limiter("POST", "alice")
+	l.limiter("POST", "bob")
+	assert.Len(t, l.limiters, 2)
+
+	now = now.Add(30 * time.Second)
+	l.limiter("POST", "alice")
+	now = now.Add(25 * time.Second)
+	l.limiter("POST", "carol")
+	assert.Len(t, l.limiters, 3)
+
+	// bob has been idle for longer than it takes to refill the bucket
+	now = now.Add(30 * time.Second)
+	l.limiter("POST", "carol")
+	assert.Contains(t, l.limiters, "POST alice")
+	assert.NotContains(t, l.limiters, "POST bob")
+	assert.Len(t, l.limiters, 2)
+}
+
+func TestUnleashExportImport(t *testing.T) {
+	_, service, router := newUnleashRoute()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/export", nil)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var export handler.UnleashExport
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+	assert.Len(t, export.Instances, 2)
+	assert.Equal(t, "team-a", export.Instances[0].Config.Name)
+	assert.Equal(t, "abc123", export.Instances[0].FederationNonce)
+	assert.Equal(t, service.Instances[1].ServerInstance.Spec.Federation.SecretNonce, export.Instances[1].FederationNonce)
+
+	original := map[string]*unleash.UnleashConfig{}
+	for _, instance := range service.Instances {
+		original[instance.Name] = unleash.UnleashVariables(instance.ServerInstance, true)
+	}
+	assert.NoError(t, service.Delete(context.Background(), "team-a", unleash.DeleteOptions{}))
+	assert.NoError(t, service.Delete(context.Background(), "team-b", unleash.DeleteOptions{}))
+
+	importBody := w.Body.String()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/unleash/import", strings.NewReader(importBody))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"results": [
+		{"name": "team-a", "status": "created"},
+		{"name": "team-b", "status": "created"}
+	]}`, w.Body.String())
+
+	assert.Len(t, service.Instances, 2)
+	for _, instance := range service.Instances {
+		imported := unleash.UnleashVariables(instance.ServerInstance, true)
+		assert.Equal(t, original[instance.Name], imported, instance.Name)
+		assert.Equal(t, original[instance.Name].FederationNonce, imported.FederationNonce, instance.Name)
+	}
+}
+
+func TestUnleashImportResults(t *testing.T) {
+	c, service, _ := newUnleashRoute()
+	c.Unleash.FederationNonceMinLength = 8
+	service.GetErrs = map[string]error{"unreachable": fmt.Errorf("connection refused")}
+
+	opa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input struct {
+				Instance unleash.UnleashConfig `json:"instance"`
+			} `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		allow := body.Input.Instance.LogLevel != "debug"
+		_ = json.NewEncoder(w).Encode(gin.H{"result": gin.H{"allow": allow, "reason": "debug logging is not allowed"}})
+	}))
+	defer opa.Close()
+
+	c.Unleash.AdmissionPolicyURL = opa.URL
+	router := setupRouter(c, logrus.New(), service)
+
+	item := func(name, nonce, logLevel string) string {
+		return fmt.Sprintf(`{"config": {"name": %q, "log-level": %q, "database-pool-max": 3, "database-pool-idle-timeout-ms": 1000}, "federation-nonce": %q}`, name, logLevel, nonce)
+	}
+	body := fmt.Sprintf(`{"instances": [%s, %s, %s, %s, %s, %s]}`,
+		item("team-a", "abcd1234", "warn"),
+		item("weak-nonce", "abc", "warn"),
+		item("bad-level", "abcd1234", "loud"),
+		item("debug", "abcd1234", "debug"),
+		item("unreachable", "abcd1234", "warn"),
+		item("team-c", "abcd1234", "warn"),
+	)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/unleash/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var response struct {
+		Results []handler.UnleashImportResult `json:"results"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	statuses := map[string]string{}
+	for _, result := range response.Results {
+		statuses[result.Name] = result.Status
+	}
+	assert.Equal(t, map[string]string{
+		"team-a":      handler.ImportStatusSkipped,
+		"weak-nonce":  handler.ImportStatusInvalid,
+		"bad-level":   handler.ImportStatusInvalid,
+		"debug":       handler.ImportStatusRejected,
+		"unreachable": handler.ImportStatusFailed,
+		"team-c":      handler.ImportStatusCreated,
+	}, statuses)
+	assert.Contains(t, response.Results[1].Reason, "weak federation nonce")
+	assert.Equal(t, "debug logging is not allowed", response.Results[3].Reason)
+
+	assert.Len(t, service.Instances, 3)
+	assert.Equal(t, "abcd1234", service.Instances[2].ServerInstance.Spec.Federation.SecretNonce)
 }
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeoutMiddleware sets a deadline on the request context, which is passed on to the Kubernetes and Cloud SQL
+// clients. The response is buffered so it can be replaced with a 504 when the deadline is exceeded. Handlers are
+// not preempted, the 504 is written once the handler returns.
+func timeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		original := c.Writer
+		writer := &bufferedResponseWriter{ResponseWriter: original}
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = writer
+		c.Next()
+		c.Writer = original
+
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			_, _ = original.Write(writer.body.Bytes())
+			return
+		}
+
+		// The timeout response replaces anything the handler produced, including errors for the error page
+		c.Errors = c.Errors[:0]
+		header := original.Header()
+		for key := range header {
+			header.Del(key)
+		}
+
+		if c.ContentType() == "application/json" || c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+			c.JSON(504, gin.H{"error": "Request timed out"})
+		} else {
+			c.String(504, "Request timed out")
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// KubeClient wraps a Kubernetes client so each call is a span named after the verb and kind, with the object name
+// as the instance attribute.
+type KubeClient struct {
+	ctrl.Client
+}
+
+func NewKubeClient(client ctrl.Client) *KubeClient {
+	return &KubeClient{Client: client}
+}
+
+func (c *KubeClient) start(ctx context.Context, verb string, obj runtime.Object, name, namespace string) (context.Context, func(error)) {
+	kind := "unknown"
+	if gvk, err := c.GroupVersionKindFor(obj); err == nil {
+		kind = gvk.Kind
+	}
+
+	ctx, span := Start(ctx, "kubernetes "+verb+" "+kind, name, attribute.String("k8s.namespace.name", namespace))
+	return ctx, func(err error) { End(span, err) }
+}
+
+func (c *KubeClient) Get(ctx context.Context, key ctrl.ObjectKey, obj ctrl.Object, opts ...ctrl.GetOption) (err error) {
+	ctx, end := c.start(ctx, "Get", obj, key.Name, key.Namespace)
+	defer func() { end(err) }()
+
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func (c *KubeClient) List(ctx context.Context, list ctrl.ObjectList, opts ...ctrl.ListOption) (err error) {
+	listOpts := &ctrl.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	ctx, end := c.start(ctx, "List", list, "", listOpts.Namespace)
+	defer func() { end(err) }()
+
+	return c.Client.List(ctx, list, opts...)
+}
+
+func (c *KubeClient) Create(ctx context.Context, obj ctrl.Object, opts ...ctrl.CreateOption) (err error) {
+	ctx, end := c.start(ctx, "Create", obj, obj.GetName(), obj.GetNamespace())
+	defer func() { end(err) }()
+
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *KubeClient) Update(ctx context.Context, obj ctrl.Object, opts ...ctrl.UpdateOption) (err error) {
+	ctx, end := c.start(ctx, "Update", obj, obj.GetName(), obj.GetNamespace())
+	defer func() { end(err) }()
+
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *KubeClient) Patch(ctx context.Context, obj ctrl.Object, patch ctrl.Patch, opts ...ctrl.PatchOption) (err error) {
+	ctx, end := c.start(ctx, "Patch", obj, obj.GetName(), obj.GetNamespace())
+	defer func() { end(err) }()
+
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *KubeClient) Delete(ctx context.Context, obj ctrl.Object, opts ...ctrl.DeleteOption) (err error) {
+	ctx, end := c.start(ctx, "Delete", obj, obj.GetName(), obj.GetNamespace())
+	defer func() { end(err) }()
+
+	return c.Client.Delete(ctx, obj, opts...)
+}
@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	client_go_scheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	propagator := otel.GetTextMapPropagator()
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	return recorder
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestSetupDisabled(t *testing.T) {
+	shutdown, err := Setup(context.Background(), &config.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, span := Start(context.Background(), "operation", "my-instance")
+	assert.False(t, span.IsRecording())
+	End(span, nil)
+}
+
+func TestGinMiddleware(t *testing.T) {
+	recorder := newSpanRecorder(t)
+
+	router := gin.New()
+	router.Use(GinMiddleware())
+	router.GET("/unleash/:id", func(c *gin.Context) {
+		_, span := Start(c.Request.Context(), "operation", c.Param("id"))
+		End(span, nil)
+		c.String(200, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unleash/my-instance", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 2) {
+		child, server := spans[0], spans[1]
+		assert.Equal(t, "GET /unleash/:id", server.Name())
+		assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", server.SpanContext().TraceID().String())
+		assert.Equal(t, "b7ad6b7169203331", server.Parent().SpanID().String())
+		assert.Equal(t, "my-instance", spanAttribute(server, InstanceKey))
+		assert.Equal(t, "200", spanAttribute(server, "http.response.status_code"))
+
+		assert.Equal(t, server.SpanContext().SpanID(), child.Parent().SpanID())
+		assert.Equal(t, "my-instance", spanAttribute(child, InstanceKey))
+	}
+}
+
+func TestKubeClient(t *testing.T) {
+	recorder := newSpanRecorder(t)
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "my-instance", Namespace: "unleash-ns"}}
+	client := NewKubeClient(fake.NewClientBuilder().WithScheme(client_go_scheme.Scheme).WithObjects(secret).Build())
+
+	ctx := context.Background()
+	assert.NoError(t, client.Get(ctx, ctrl.ObjectKeyFromObject(secret), &corev1.Secret{}))
+	assert.Error(t, client.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "unleash-ns"}}))
+	assert.NoError(t, client.List(ctx, &corev1.SecretList{}, ctrl.InNamespace("unleash-ns")))
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 3) {
+		assert.Equal(t, "kubernetes Get Secret", spans[0].Name())
+		assert.Equal(t, "my-instance", spanAttribute(spans[0], InstanceKey))
+		assert.Equal(t, "unleash-ns", spanAttribute(spans[0], "k8s.namespace.name"))
+
+		assert.Equal(t, "kubernetes Delete Secret", spans[1].Name())
+		assert.Equal(t, "other", spanAttribute(spans[1], InstanceKey))
+		assert.Equal(t, "Error", spans[1].Status().Code.String())
+
+		assert.Equal(t, "kubernetes List SecretList", spans[2].Name())
+		assert.Equal(t, "unleash-ns", spanAttribute(spans[2], "k8s.namespace.name"))
+	}
+}
@@ -0,0 +1,170 @@
+package unleash
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	ArchivedAtAnnotationKey     = "bifrost.nais.io/archived-at"
+	archivedConfigAnnotationKey = "bifrost.nais.io/archived-config"
+	archivedNonceAnnotationKey  = "bifrost.nais.io/archived-federation-nonce"
+)
+
+var ErrInstanceNotArchived = errors.New("instance is not archived")
+
+var ErrInstanceArchived = errors.New("instance is archived")
+
+func isArchivedSecret(secret *corev1.Secret) bool {
+	_, ok := secret.GetAnnotations()[ArchivedAtAnnotationKey]
+	return ok
+}
+
+// archiveServer stores the instance config on the database secret and removes the Unleash resource and FQDN
+// policy, keeping the database, database user and secret so the instance can be restored. The Unleash resource
+// is removed rather than scaled down, see drainServer.
+func (s *UnleashService) archiveServer(ctx context.Context, name string) error {
+	namespace := s.config.Unleash.InstanceNamespace
+
+	server, err := getServer(ctx, s.kubeClient, namespace, name)
+	if err != nil {
+		return err
+	}
+
+	secret, err := getDatabaseUserSecret(ctx, s.kubeClient, namespace, name)
+	if err != nil {
+		return err
+	}
+
+	uc := UnleashVariables(server, false)
+	data, err := json.Marshal(uc)
+	if err != nil {
+		return err
+	}
+
+	annotations := secret.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[ArchivedAtAnnotationKey] = time.Now().UTC().Format(time.RFC3339)
+	annotations[archivedConfigAnnotationKey] = string(data)
+	annotations[archivedNonceAnnotationKey] = uc.FederationNonce
+	secret.SetAnnotations(annotations)
+
+	if err := s.kubeClient.Update(ctx, secret); err != nil {
+		return &UnleashError{Err: err, Reason: "failed to archive database user secret"}
+	}
+
+	serverErr := deleteServer(ctx, s.kubeClient, namespace, name)
+	netPolErr := deleteFQDNNetworkPolicy(ctx, s.kubeClient, namespace, name)
+
+	return errors.Join(serverErr, netPolErr)
+}
+
+// isArchived reports whether name has an archived database secret, and so can only be restored and not created.
+func (s *UnleashService) isArchived(ctx context.Context, name string) (bool, error) {
+	secret := &corev1.Secret{}
+	err := s.kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: s.config.Unleash.InstanceNamespace, Name: name}, secret)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return isArchivedSecret(secret), nil
+}
+
+func archivedUnleashConfig(secret *corev1.Secret) (*UnleashConfig, error) {
+	if !isArchivedSecret(secret) {
+		return nil, ErrInstanceNotArchived
+	}
+
+	uc := &UnleashConfig{}
+	if err := json.Unmarshal([]byte(secret.GetAnnotations()[archivedConfigAnnotationKey]), uc); err != nil {
+		return nil, &UnleashError{Err: err, Reason: "failed to parse archived instance config"}
+	}
+	uc.FederationNonce = secret.GetAnnotations()[archivedNonceAnnotationKey]
+
+	return uc, nil
+}
+
+func (s *UnleashService) ListArchived(ctx context.Context) ([]*UnleashInstance, error) {
+	secrets := corev1.SecretList{}
+	if err := s.kubeClient.List(ctx, &secrets, &ctrl.ListOptions{Namespace: s.config.Unleash.InstanceNamespace}); err != nil {
+		return nil, err
+	}
+
+	instances := []*UnleashInstance{}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if !isArchivedSecret(secret) {
+			continue
+		}
+
+		uc, err := archivedUnleashConfig(secret)
+		if err != nil {
+			s.logger.WithError(err).WithField("instance", secret.Name).Warn("Skipping archived instance")
+			continue
+		}
+
+		server := UnleashDefinition(s.config, uc)
+		instance := NewUnleashInstance(&server)
+		instance.CreatedAt = secret.CreationTimestamp
+		instance.Archived = true
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
+
+func (s *UnleashService) Restore(ctx context.Context, name string) (*unleashv1.Unleash, error) {
+	namespace := s.config.Unleash.InstanceNamespace
+
+	secret, err := getDatabaseUserSecret(ctx, s.kubeClient, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	uc, err := archivedUnleashConfig(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	// The policy and server are left behind by a restore that failed to unarchive the secret, so a retry takes them
+	// over instead of failing on them
+	err = createFQDNNetworkPolicy(ctx, s.kubeClient, namespace, name, ResourceLabels(s.config), PolicyEgressFQDNs(s.config, uc))
+	if apierrors.IsAlreadyExists(err) {
+		err = updateFQDNNetworkPolicy(ctx, s.kubeClient, namespace, name, ResourceLabels(s.config), PolicyEgressFQDNs(s.config, uc))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := createServer(ctx, s.kubeClient, s.config, uc)
+	if apierrors.IsAlreadyExists(err) {
+		server, err = updateServer(ctx, s.kubeClient, s.config, uc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := secret.GetAnnotations()
+	delete(annotations, ArchivedAtAnnotationKey)
+	delete(annotations, archivedConfigAnnotationKey)
+	delete(annotations, archivedNonceAnnotationKey)
+	secret.SetAnnotations(annotations)
+
+	if err := s.kubeClient.Update(ctx, secret); err != nil {
+		return server, &UnleashError{Err: err, Reason: "failed to unarchive database user secret"}
+	}
+
+	return server, nil
+}
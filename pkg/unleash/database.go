@@ -4,36 +4,135 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
 
+	"github.com/nais/bifrost/pkg/metrics"
+	"github.com/nais/bifrost/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/googleapi"
 	admin "google.golang.org/api/sqladmin/v1beta4"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func createDatabase(ctx context.Context, client ISQLDatabasesService, projectName, instanceName, databaseName string) (*admin.Database, error) {
+var retryableSQLStatusCodes = map[int]bool{
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusServiceUnavailable:  true,
+}
+
+type sqlRetry struct {
+	attempts int
+	delay    time.Duration
+}
+
+func isRetryableSQLError(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && retryableSQLStatusCodes[apiErr.Code]
+}
+
+// do calls fn until it succeeds, fails with a non-retryable error or the attempts are used up, doubling the
+// delay between each attempt.
+func (r sqlRetry) do(ctx context.Context, fn func() error) error {
+	delay := r.delay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !isRetryableSQLError(err) || attempt >= r.attempts {
+			return err
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		}
+		delay *= 2
+	}
+}
+
+// databaseErrorClass groups Cloud SQL Admin API and Kubernetes errors into a small set of metric labels.
+func databaseErrorClass(err error) string {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Code == http.StatusNotFound:
+			return "not_found"
+		case apiErr.Code == http.StatusConflict:
+			return "conflict"
+		case apiErr.Code == http.StatusTooManyRequests:
+			return "rate_limited"
+		case apiErr.Code == http.StatusUnauthorized || apiErr.Code == http.StatusForbidden:
+			return "permission_denied"
+		case apiErr.Code >= 500:
+			return "server_error"
+		default:
+			return "client_error"
+		}
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled):
+		return "timeout"
+	case apierrors.IsNotFound(err):
+		return "not_found"
+	case apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err):
+		return "conflict"
+	case apierrors.IsTooManyRequests(err):
+		return "rate_limited"
+	case apierrors.IsUnauthorized(err) || apierrors.IsForbidden(err):
+		return "permission_denied"
+	}
+
+	return "other"
+}
+
+// startSQLSpan starts a span for a Cloud SQL Admin API call on the database or user for an Unleash instance.
+func startSQLSpan(ctx context.Context, operation, sqlInstance, name string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "cloudsql "+operation, name, attribute.String("cloudsql.instance", sqlInstance))
+}
+
+func databaseOperationError(operation string, err error, reason string) *UnleashError {
+	metrics.ObserveDatabaseOperationError(operation, databaseErrorClass(err))
+	return &UnleashError{Err: err, Reason: reason}
+}
+
+func createDatabase(ctx context.Context, client ISQLDatabasesService, retry sqlRetry, projectName, instanceName, databaseName, charset, collation string) (*admin.Database, error) {
 	database := &admin.Database{
-		Name: databaseName,
+		Name:      databaseName,
+		Charset:   charset,
+		Collation: collation,
 	}
 
-	_, err := client.Insert(projectName, instanceName, database).Context(ctx).Do()
+	err := retry.do(ctx, func() error {
+		ctx, span := startSQLSpan(ctx, "databases.insert", instanceName, databaseName)
+		_, err := client.Insert(projectName, instanceName, database).Context(ctx).Do()
+		tracing.End(span, err)
+		return err
+	})
 	if err != nil {
-		return database, &UnleashError{Err: err, Reason: "failed to create database"}
+		return database, databaseOperationError("create_database", err, "failed to create database")
 	}
 
 	return database, nil
 }
 
 func getDatabaseUser(ctx context.Context, client ISQLUsersService, projectName, instanceName, databaseName string) (*admin.User, error) {
+	ctx, span := startSQLSpan(ctx, "users.get", instanceName, databaseName)
 	user, err := client.Get(projectName, instanceName, databaseName).Context(ctx).Do()
+	tracing.End(span, err)
 	if err != nil {
-		return user, &UnleashError{Err: err, Reason: "failed to get database user"}
+		return user, databaseOperationError("get_user", err, "failed to get database user")
 	}
 
 	return user, nil
 }
 
-func createDatabaseUser(ctx context.Context, client ISQLUsersService, projectName, instanceName, databaseName string) (*admin.User, error) {
+func createDatabaseUser(ctx context.Context, client ISQLUsersService, retry sqlRetry, projectName, instanceName, databaseName string) (*admin.User, error) {
 	password, err := randomPassword(16)
 	if err != nil {
 		return nil, err
@@ -44,18 +143,46 @@ func createDatabaseUser(ctx context.Context, client ISQLUsersService, projectNam
 		Password: password,
 	}
 
-	_, err = client.Insert(projectName, instanceName, user).Context(ctx).Do()
+	err = retry.do(ctx, func() error {
+		ctx, span := startSQLSpan(ctx, "users.insert", instanceName, databaseName)
+		_, err := client.Insert(projectName, instanceName, user).Context(ctx).Do()
+		tracing.End(span, err)
+		return err
+	})
 	if err != nil {
-		return user, &UnleashError{Err: err, Reason: "failed to create database user"}
+		return user, databaseOperationError("create_user", err, "failed to create database user")
+	}
+
+	return user, nil
+}
+
+func updateDatabaseUserPassword(ctx context.Context, client ISQLUsersService, projectName, instanceName, databaseName string) (*admin.User, error) {
+	password, err := randomPassword(16)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &admin.User{
+		Name:     databaseName,
+		Password: password,
+	}
+
+	ctx, span := startSQLSpan(ctx, "users.update", instanceName, databaseName)
+	_, err = client.Update(projectName, instanceName, user).Name(databaseName).Context(ctx).Do()
+	tracing.End(span, err)
+	if err != nil {
+		return user, databaseOperationError("update_user", err, "failed to update database user password")
 	}
 
 	return user, nil
 }
 
 func deleteDatabaseUser(ctx context.Context, client ISQLUsersService, projectName, instanceName, databaseName string) error {
+	ctx, span := startSQLSpan(ctx, "users.delete", instanceName, databaseName)
 	_, err := client.Delete(projectName, instanceName).Name(databaseName).Context(ctx).Do()
+	tracing.End(span, err)
 	if err != nil {
-		return &UnleashError{Err: err, Reason: "failed to delete database user"}
+		return databaseOperationError("delete_user", err, "failed to delete database user")
 	}
 
 	return nil
@@ -74,28 +201,33 @@ func randomPassword(length int) (string, error) {
 }
 
 func getDatabase(ctx context.Context, client ISQLDatabasesService, projectName, instanceName, databaseName string) (*admin.Database, error) {
-	database, err := client.Get(projectName, instanceName, databaseName).Do()
+	ctx, span := startSQLSpan(ctx, "databases.get", instanceName, databaseName)
+	database, err := client.Get(projectName, instanceName, databaseName).Context(ctx).Do()
+	tracing.End(span, err)
 	if err != nil {
-		return database, &UnleashError{Err: err, Reason: "failed to get database"}
+		return database, databaseOperationError("get_database", err, "failed to get database")
 	}
 
 	return database, nil
 }
 
 func deleteDatabase(ctx context.Context, client ISQLDatabasesService, projectName, instanceName, databaseName string) error {
-	_, err := client.Delete(projectName, instanceName, databaseName).Do()
+	ctx, span := startSQLSpan(ctx, "databases.delete", instanceName, databaseName)
+	_, err := client.Delete(projectName, instanceName, databaseName).Context(ctx).Do()
+	tracing.End(span, err)
 	if err != nil {
-		return &UnleashError{Err: err, Reason: "failed to delete database"}
+		return databaseOperationError("delete_database", err, "failed to delete database")
 	}
 
 	return nil
 }
 
-func createDatabaseUserSecret(ctx context.Context, client ctrl.Client, namespace, instanceName, instanceAddress, projectName string, database *admin.Database, user *admin.User) error {
+func createDatabaseUserSecret(ctx context.Context, client ctrl.Client, namespace, instanceName, instanceAddress, projectName string, database *admin.Database, user *admin.User, labels map[string]string) error {
 	secret := &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      database.Name,
 			Namespace: namespace,
+			Labels:    labels,
 		},
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Secret",
@@ -110,7 +242,29 @@ func createDatabaseUserSecret(ctx context.Context, client ctrl.Client, namespace
 	}
 
 	if err := client.Create(ctx, secret); err != nil {
-		return &UnleashError{Err: err, Reason: "failed to create database user secret"}
+		return databaseOperationError("create_secret", err, "failed to create database user secret")
+	}
+
+	return nil
+}
+
+func getDatabaseUserSecret(ctx context.Context, client ctrl.Client, namespace string, databaseName string) (*v1.Secret, error) {
+	secret := &v1.Secret{}
+	if err := client.Get(ctx, ctrl.ObjectKey{Namespace: namespace, Name: databaseName}, secret); err != nil {
+		return nil, databaseOperationError("get_secret", err, "failed to get database user secret")
+	}
+
+	return secret, nil
+}
+
+func updateDatabaseUserSecret(ctx context.Context, client ctrl.Client, secret *v1.Secret, user *admin.User) error {
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data["POSTGRES_PASSWORD"] = []byte(user.Password)
+
+	if err := client.Update(ctx, secret); err != nil {
+		return databaseOperationError("update_secret", err, "failed to update database user secret")
 	}
 
 	return nil
@@ -129,7 +283,7 @@ func deleteDatabaseUserSecret(ctx context.Context, client ctrl.Client, namespace
 	}
 
 	if err := client.Delete(ctx, secret); err != nil {
-		return &UnleashError{Err: err, Reason: "failed to delete database user secret"}
+		return databaseOperationError("delete_secret", err, "failed to delete database user secret")
 	}
 
 	return nil
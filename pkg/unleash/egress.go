@@ -0,0 +1,136 @@
+package unleash
+
+import (
+	"context"
+	"fmt"
+
+	fqdnV1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/utils"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+const (
+	EgressRuleTypeCIDR = "cidr"
+	EgressRuleTypeFQDN = "fqdn"
+
+	EgressSourceDefault  = "default"
+	EgressSourceGlobal   = "global"
+	EgressSourceInstance = "instance"
+)
+
+type EgressRule struct {
+	Type         string            `json:"type"`
+	Destinations []string          `json:"destinations"`
+	Ports        []string          `json:"ports"`
+	Sources      map[string]string `json:"sources,omitempty"`
+}
+
+type EgressSummary struct {
+	AllowDNS bool         `json:"allow-dns"`
+	Rules    []EgressRule `json:"rules"`
+}
+
+func egressPorts(ports []networkingv1.NetworkPolicyPort) []string {
+	result := []string{}
+	for _, port := range ports {
+		protocol := "TCP"
+		if port.Protocol != nil {
+			protocol = string(*port.Protocol)
+		}
+		if port.Port != nil {
+			result = append(result, fmt.Sprintf("%s/%s", protocol, port.Port.String()))
+		} else {
+			result = append(result, protocol)
+		}
+	}
+	return result
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+// NewEgressSummary combines the extra egress rules of the Unleash network policy and the FQDN network policy.
+// FQDN destinations are attributed to the built-in defaults, the FQDNs configured for all instances or the
+// FQDNs requested for this instance.
+func NewEgressSummary(c *config.Config, server *unleashv1.Unleash, fqdn *fqdnV1alpha3.FQDNNetworkPolicy) *EgressSummary {
+	summary := &EgressSummary{Rules: []EgressRule{}}
+
+	defaults := stringSet(DefaultEgressFQDNs)
+	global := stringSet(egressFQDNs(utils.SplitNoEmpty(c.Unleash.ExtraEgressFQDNs, ","))[len(DefaultEgressFQDNs):])
+	instance := map[string]bool{}
+	if server != nil {
+		instance = stringSet(UnleashVariables(server, false).ExtraEgressFQDNs())
+	}
+
+	source := func(destination string) string {
+		switch {
+		case defaults[destination]:
+			return EgressSourceDefault
+		case global[destination]:
+			return EgressSourceGlobal
+		case instance[destination]:
+			return EgressSourceInstance
+		default:
+			return EgressSourceDefault
+		}
+	}
+
+	if server != nil {
+		summary.AllowDNS = server.Spec.NetworkPolicy.AllowDNS
+		for _, rule := range server.Spec.NetworkPolicy.ExtraEgressRules {
+			destinations := []string{}
+			for _, peer := range rule.To {
+				if peer.IPBlock != nil {
+					destinations = append(destinations, peer.IPBlock.CIDR)
+				}
+			}
+			summary.Rules = append(summary.Rules, EgressRule{
+				Type:         EgressRuleTypeCIDR,
+				Destinations: destinations,
+				Ports:        egressPorts(rule.Ports),
+			})
+		}
+	}
+
+	if fqdn != nil {
+		for _, rule := range fqdn.Spec.Egress {
+			destinations := []string{}
+			sources := map[string]string{}
+			for _, peer := range rule.To {
+				for _, destination := range peer.FQDNs {
+					destinations = append(destinations, destination)
+					sources[destination] = source(destination)
+				}
+			}
+			summary.Rules = append(summary.Rules, EgressRule{
+				Type:         EgressRuleTypeFQDN,
+				Destinations: destinations,
+				Ports:        egressPorts(rule.Ports),
+				Sources:      sources,
+			})
+		}
+	}
+
+	return summary
+}
+
+func (s *UnleashService) Egress(ctx context.Context, name string) (*EgressSummary, error) {
+	server, err := getServer(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	fqdn, err := getFQDNNetworkPolicy(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEgressSummary(s.config, server, fqdn), nil
+}
@@ -8,3 +8,7 @@ type UnleashError struct {
 func (e *UnleashError) Error() string {
 	return e.Reason
 }
+
+func (e *UnleashError) Unwrap() error {
+	return e.Err
+}
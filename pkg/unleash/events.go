@@ -0,0 +1,157 @@
+package unleash
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	EventActionCreate = "create"
+	EventActionUpdate = "update"
+	EventActionDelete = "delete"
+
+	EventVersionSourceCustom  = "custom"
+	EventVersionSourceDefault = "default"
+)
+
+type Event struct {
+	Action        string    `json:"action"`
+	Name          string    `json:"name"`
+	VersionSource string    `json:"version-source,omitempty"`
+	Version       string    `json:"version,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+func newInstanceEvent(action string, uc *UnleashConfig) Event {
+	event := Event{Action: action, Name: uc.Name, VersionSource: EventVersionSourceDefault, Timestamp: time.Now().UTC()}
+	if uc.CustomVersion != "" {
+		event.VersionSource = EventVersionSourceCustom
+		event.Version = uc.CustomVersion
+	}
+	return event
+}
+
+// EventPublisher is notified after instances have been successfully created, updated or deleted. Publish must
+// not block the caller. Close stops accepting events and waits until queued events are sent or ctx is done.
+type EventPublisher interface {
+	Publish(event Event)
+	Close(ctx context.Context) error
+}
+
+func NewEventPublisher(c *config.Config, logger *logrus.Logger) EventPublisher {
+	if c.Unleash.EventWebhookURL == "" {
+		return NoopEventPublisher{}
+	}
+
+	queueSize := c.Unleash.EventQueueSize
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	p := &WebhookEventPublisher{
+		url:    c.Unleash.EventWebhookURL,
+		client: &http.Client{Timeout: 5 * time.Second},
+		logger: logger,
+		queue:  make(chan Event, queueSize),
+		done:   make(chan struct{}),
+	}
+	go p.run()
+
+	return p
+}
+
+type NoopEventPublisher struct{}
+
+func (NoopEventPublisher) Publish(event Event) {}
+
+func (NoopEventPublisher) Close(ctx context.Context) error { return nil }
+
+// WebhookEventPublisher POSTs events as JSON to a webhook URL from a background worker. Events are dropped with a
+// warning when the queue is full or the publisher is closed.
+type WebhookEventPublisher struct {
+	url    string
+	client *http.Client
+	logger *logrus.Logger
+	queue  chan Event
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func (p *WebhookEventPublisher) Publish(event Event) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		p.logger.WithFields(logrus.Fields{"action": event.Action, "instance": event.Name}).Warn("Event publisher is closed, dropping event")
+		return
+	}
+
+	select {
+	case p.queue <- event:
+	default:
+		p.logger.WithFields(logrus.Fields{"action": event.Action, "instance": event.Name}).Warn("Event queue is full, dropping event")
+	}
+}
+
+// Close stops the worker once it has sent the queued events. It returns an error if ctx is done first, the worker
+// keeps sending in the background until the queue is empty.
+func (p *WebhookEventPublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d queued events not published: %w", len(p.queue), ctx.Err())
+	}
+}
+
+func (p *WebhookEventPublisher) run() {
+	defer close(p.done)
+
+	for event := range p.queue {
+		if err := p.send(event); err != nil {
+			p.logger.WithError(err).WithFields(logrus.Fields{"action": event.Action, "instance": event.Name}).Warn("Failed to publish event")
+		}
+	}
+}
+
+func (p *WebhookEventPublisher) send(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code from event webhook: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package unleash
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEventServer(t *testing.T) (*httptest.Server, chan Event) {
+	events := make(chan Event, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var event Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events <- event
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, events
+}
+
+func receiveEvent(t *testing.T, events chan Event) Event {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return Event{}
+	}
+}
+
+func TestNewEventPublisher(t *testing.T) {
+	assert.IsType(t, NoopEventPublisher{}, NewEventPublisher(&config.Config{}, logrus.New()))
+	assert.IsType(t, &WebhookEventPublisher{}, NewEventPublisher(&config.Config{Unleash: config.UnleashConfig{EventWebhookURL: "http://webhook"}}, logrus.New()))
+}
+
+func TestUnleashServiceEvents(t *testing.T) {
+	ctx := context.Background()
+	server, events := newEventServer(t)
+
+	c := newTestConfig()
+	c.Unleash.EventWebhookURL = server.URL
+	c.Unleash.EventQueueSize = 10
+	service, _, _ := newTestService(t, c)
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", CustomVersion: "v5.1.2"})
+	assert.NoError(t, err)
+
+	event := receiveEvent(t, events)
+	assert.Equal(t, EventActionCreate, event.Action)
+	assert.Equal(t, "my-instance", event.Name)
+	assert.Equal(t, EventVersionSourceCustom, event.VersionSource)
+	assert.Equal(t, "v5.1.2", event.Version)
+	assert.False(t, event.Timestamp.IsZero())
+
+	_, err = service.Update(ctx, &UnleashConfig{Name: "my-instance"})
+	assert.NoError(t, err)
+
+	event = receiveEvent(t, events)
+	assert.Equal(t, EventActionUpdate, event.Action)
+	assert.Equal(t, "my-instance", event.Name)
+	assert.Equal(t, EventVersionSourceDefault, event.VersionSource)
+	assert.Empty(t, event.Version)
+
+	assert.NoError(t, service.Delete(ctx, "my-instance", DeleteOptions{}))
+
+	event = receiveEvent(t, events)
+	assert.Equal(t, EventActionDelete, event.Action)
+	assert.Equal(t, "my-instance", event.Name)
+}
+
+func TestWebhookEventPublisherClose(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+
+		var event Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received <- event.Name
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	logger, hook := test.NewNullLogger()
+	p := NewEventPublisher(&config.Config{Unleash: config.UnleashConfig{EventWebhookURL: server.URL, EventQueueSize: 10}}, logger)
+
+	p.Publish(Event{Action: EventActionCreate, Name: "a"})
+	p.Publish(Event{Action: EventActionCreate, Name: "b"})
+	p.Publish(Event{Action: EventActionCreate, Name: "c"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, p.Close(ctx), context.DeadlineExceeded)
+
+	close(release)
+	assert.NoError(t, p.Close(context.Background()))
+	close(received)
+
+	names := []string{}
+	for name := range received {
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+
+	p.Publish(Event{Action: EventActionCreate, Name: "d"})
+	if assert.NotNil(t, hook.LastEntry()) {
+		assert.Equal(t, "Event publisher is closed, dropping event", hook.LastEntry().Message)
+	}
+}
+
+func TestWebhookEventPublisherDropsWhenFull(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	p := &WebhookEventPublisher{logger: logger, queue: make(chan Event, 1)}
+
+	p.Publish(Event{Action: EventActionCreate, Name: "a"})
+	p.Publish(Event{Action: EventActionCreate, Name: "b"})
+
+	assert.Len(t, p.queue, 1)
+	assert.Equal(t, "a", (<-p.queue).Name)
+	if assert.Len(t, hook.AllEntries(), 1) {
+		assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+		assert.Equal(t, "b", hook.LastEntry().Data["instance"])
+	}
+}
@@ -3,13 +3,16 @@ package unleash
 import (
 	"context"
 	"fmt"
+	"time"
 
 	fqdnV1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
 	"github.com/nais/bifrost/pkg/config"
 	"github.com/nais/bifrost/pkg/utils"
 	unleashv1 "github.com/nais/unleasherator/api/v1"
 	admin "google.golang.org/api/sqladmin/v1beta4"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -24,6 +27,7 @@ type UnleashInstance struct {
 	Database             *admin.Database
 	DatabaseUser         *admin.User
 	DatabaseSecret       *corev1.Secret
+	Archived             bool
 }
 
 func NewUnleashInstance(serverInstance *unleashv1.Unleash) *UnleashInstance {
@@ -64,6 +68,9 @@ func (u *UnleashInstance) IsReady() bool {
 }
 
 func (u *UnleashInstance) Status() string {
+	if u.Archived {
+		return "Archived"
+	}
 	if u.ServerInstance != nil {
 		if u.ServerInstance.IsReady() {
 			return "Ready"
@@ -84,6 +91,9 @@ func (u *UnleashInstance) Version() string {
 }
 
 func (u *UnleashInstance) StatusLabel() string {
+	if u.Archived {
+		return "grey"
+	}
 	if u.ServerInstance != nil {
 		if u.ServerInstance.IsReady() {
 			return "green"
@@ -95,6 +105,74 @@ func (u *UnleashInstance) StatusLabel() string {
 	}
 }
 
+type UnleashRuntimeConfig struct {
+	LogLevel                  string   `json:"log-level"`
+	DatabasePoolMax           int      `json:"database-pool-max"`
+	DatabasePoolIdleTimeoutMs int      `json:"database-pool-idle-timeout-ms"`
+	SQLProxyImage             string   `json:"sql-proxy-image"`
+	ManagedEnvVars            []string `json:"managed-env-vars"`
+	ExtraEnvVars              []string `json:"extra-env-vars"`
+}
+
+func (u *UnleashInstance) RuntimeConfig() *UnleashRuntimeConfig {
+	if u.ServerInstance == nil {
+		return &UnleashRuntimeConfig{ManagedEnvVars: []string{}, ExtraEnvVars: []string{}}
+	}
+
+	uc := UnleashVariables(u.ServerInstance, true)
+	managed, extra := splitServerEnvVars(u.ServerInstance)
+
+	return &UnleashRuntimeConfig{
+		LogLevel:                  uc.LogLevel,
+		DatabasePoolMax:           uc.DatabasePoolMax,
+		DatabasePoolIdleTimeoutMs: uc.DatabasePoolIdleTimeoutMs,
+		SQLProxyImage:             sqlProxyImage(u.ServerInstance),
+		ManagedEnvVars:            managed,
+		ExtraEnvVars:              extra,
+	}
+}
+
+type UnleashConfigChecksum struct {
+	Checksum       string `json:"checksum"`
+	StoredChecksum string `json:"stored-checksum"`
+	Drift          bool   `json:"drift"`
+}
+
+func (u *UnleashInstance) ConfigChecksum() *UnleashConfigChecksum {
+	if u.ServerInstance == nil {
+		return &UnleashConfigChecksum{}
+	}
+
+	checksum := UnleashVariables(u.ServerInstance, false).Checksum()
+	stored := u.ServerInstance.GetAnnotations()[ConfigChecksumAnnotationKey]
+
+	return &UnleashConfigChecksum{
+		Checksum:       checksum,
+		StoredChecksum: stored,
+		Drift:          stored != checksum,
+	}
+}
+
+// Manifest returns a copy of the Unleash resource without server managed metadata and status, suitable for
+// applying elsewhere.
+func (u *UnleashInstance) Manifest() *unleashv1.Unleash {
+	if u.ServerInstance == nil {
+		return nil
+	}
+
+	manifest := u.ServerInstance.DeepCopy()
+	manifest.TypeMeta = metav1.TypeMeta{Kind: "Unleash", APIVersion: "unleash.nais.io/v1"}
+	manifest.ObjectMeta = metav1.ObjectMeta{
+		Name:        manifest.Name,
+		Namespace:   manifest.Namespace,
+		Labels:      manifest.Labels,
+		Annotations: manifest.Annotations,
+	}
+	manifest.Status = unleashv1.UnleashStatus{}
+
+	return manifest
+}
+
 func (u *UnleashInstance) GetDatabase(ctx context.Context, client *admin.DatabasesService) error {
 	database, err := getDatabase(ctx, client, u.DatabaseInstanceName, u.DatabaseProjectName, u.Name)
 	if err != nil {
@@ -134,6 +212,44 @@ func deleteServer(ctx context.Context, kubeClient ctrl.Client, kubeNamespace str
 	return nil
 }
 
+// getReadyReplicas returns the number of ready pods for the server deployment, or zero when it does not exist yet.
+func getReadyReplicas(ctx context.Context, kubeClient ctrl.Client, kubeNamespace string, name string) (int32, error) {
+	deployment := &appsv1.Deployment{}
+	if err := kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: kubeNamespace, Name: name}, deployment); err != nil {
+		if apierrors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, &UnleashError{Err: err, Reason: "failed to get server deployment"}
+	}
+
+	return deployment.Status.ReadyReplicas, nil
+}
+
+// drainServer scales the deployment of an instance to zero and waits for in-flight connections to drain. The
+// Unleash resource itself can not be scaled to zero as its size defaults to one.
+func drainServer(ctx context.Context, kubeClient ctrl.Client, kubeNamespace string, name string, wait time.Duration) error {
+	deployment := &appsv1.Deployment{}
+	if err := kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: kubeNamespace, Name: name}, deployment); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return &UnleashError{Err: err, Reason: "failed to get server deployment"}
+	}
+
+	replicas := int32(0)
+	deployment.Spec.Replicas = &replicas
+	if err := kubeClient.Update(ctx, deployment); err != nil {
+		return &UnleashError{Err: err, Reason: "failed to scale down server deployment"}
+	}
+
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func createServer(ctx context.Context, kubeClient ctrl.Client, config *config.Config, uc *UnleashConfig) (*unleashv1.Unleash, error) {
 	unleashDefinition := UnleashDefinition(config, uc)
 	if err := kubeClient.Create(ctx, &unleashDefinition); err != nil {
@@ -148,12 +264,27 @@ func updateServer(ctx context.Context, kubeClient ctrl.Client, config *config.Co
 		return nil, err
 	}
 
+	// The database stays on the SQL instance the server was placed on
+	uc.SQLInstanceID = unleashDefinitionOld.GetAnnotations()[SQLInstanceAnnotationKey]
+
 	unleashDefinitionNew := UnleashDefinition(config, uc)
 	unleashDefinitionNew.ObjectMeta.ResourceVersion = unleashDefinitionOld.ObjectMeta.ResourceVersion
 	unleashDefinitionNew.ObjectMeta.CreationTimestamp = unleashDefinitionOld.ObjectMeta.CreationTimestamp
 	unleashDefinitionNew.ObjectMeta.Generation = unleashDefinitionOld.ObjectMeta.Generation
 	unleashDefinitionNew.ObjectMeta.UID = unleashDefinitionOld.ObjectMeta.UID
 
+	// Keep labels and annotations owned by the operator or other controllers, user metadata is replaced
+	for key, value := range unleashDefinitionOld.GetLabels() {
+		if _, ok := unleashDefinitionNew.Labels[key]; !ok && isReservedMetadataKey(key) {
+			unleashDefinitionNew.Labels[key] = value
+		}
+	}
+	for key, value := range unleashDefinitionOld.GetAnnotations() {
+		if _, ok := unleashDefinitionNew.Annotations[key]; !ok && isReservedMetadataKey(key) && key != AllowedEgressFQDNsAnnotationKey {
+			unleashDefinitionNew.Annotations[key] = value
+		}
+	}
+
 	if err := kubeClient.Update(ctx, &unleashDefinitionNew); err != nil {
 		return nil, &UnleashError{Err: err, Reason: "failed to update server instance"}
 	}
@@ -177,21 +308,21 @@ func deleteFQDNNetworkPolicy(ctx context.Context, kubeClient ctrl.Client, kubeNa
 	return nil
 }
 
-func createFQDNNetworkPolicy(ctx context.Context, kubeClient ctrl.Client, kubeNamespace string, name string) error {
-	fqdn := FQDNNetworkPolicyDefinition(name, kubeNamespace)
+func createFQDNNetworkPolicy(ctx context.Context, kubeClient ctrl.Client, kubeNamespace string, name string, labels map[string]string, extraFQDNs []string) error {
+	fqdn := FQDNNetworkPolicyDefinition(name, kubeNamespace, labels, extraFQDNs)
 	if err := kubeClient.Create(ctx, &fqdn); err != nil {
 		return &UnleashError{Err: err, Reason: "failed to create fqdn network policy"}
 	}
 	return nil
 }
 
-func updateFQDNNetworkPolicy(ctx context.Context, kubeClient ctrl.Client, kubeNamespace string, name string) error {
+func updateFQDNNetworkPolicy(ctx context.Context, kubeClient ctrl.Client, kubeNamespace string, name string, labels map[string]string, extraFQDNs []string) error {
 	fqdnOld, err := getFQDNNetworkPolicy(ctx, kubeClient, kubeNamespace, name)
 	if err != nil {
 		return err
 	}
 
-	fqdnNew := FQDNNetworkPolicyDefinition(name, kubeNamespace)
+	fqdnNew := FQDNNetworkPolicyDefinition(name, kubeNamespace, labels, extraFQDNs)
 	fqdnNew.ObjectMeta.ResourceVersion = fqdnOld.ObjectMeta.ResourceVersion
 	fqdnNew.ObjectMeta.CreationTimestamp = fqdnOld.ObjectMeta.CreationTimestamp
 	fqdnNew.ObjectMeta.Generation = fqdnOld.ObjectMeta.Generation
@@ -4,9 +4,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/nais/bifrost/pkg/config"
 	"github.com/stretchr/testify/assert"
 
 	unleashv1 "github.com/nais/unleasherator/api/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -203,3 +205,61 @@ func TestUnleashInstance_StatusLabel(t *testing.T) {
 	got = instance.StatusLabel()
 	assert.Equal(t, "orange", got)
 }
+
+func TestUnleashInstance_RuntimeConfig(t *testing.T) {
+	c := &config.Config{CloudConnectorProxy: "repo/connector:1.2.3"}
+	server := UnleashDefinition(c, &UnleashConfig{
+		Name:                      "my-instance",
+		LogLevel:                  "info",
+		DatabasePoolMax:           5,
+		DatabasePoolIdleTimeoutMs: 2000,
+	})
+
+	instance := NewUnleashInstance(&server)
+	assert.Equal(t, &UnleashRuntimeConfig{
+		LogLevel:                  "info",
+		DatabasePoolMax:           5,
+		DatabasePoolIdleTimeoutMs: 2000,
+		SQLProxyImage:             "repo/connector:1.2.3",
+		ManagedEnvVars:            ManagedEnvVars,
+		ExtraEnvVars:              []string{},
+	}, instance.RuntimeConfig())
+
+	server.Spec.ExtraContainers = nil
+	assert.Equal(t, "", instance.RuntimeConfig().SQLProxyImage)
+
+	server.Spec.ExtraEnvVars = append(server.Spec.ExtraEnvVars, corev1.EnvVar{Name: "UNLEASH_EXTRA", Value: "true"})
+	runtimeConfig := instance.RuntimeConfig()
+	assert.Equal(t, ManagedEnvVars, runtimeConfig.ManagedEnvVars)
+	assert.Equal(t, []string{"UNLEASH_EXTRA"}, runtimeConfig.ExtraEnvVars)
+}
+
+func TestUnleashInstance_ConfigChecksum(t *testing.T) {
+	server := UnleashDefinition(&config.Config{}, &UnleashConfig{
+		Name:                      "my-instance",
+		CustomVersion:             "v5.10.2-20240329-070801-0180a96",
+		AllowedTeams:              "team-a",
+		LogLevel:                  "warn",
+		DatabasePoolMax:           3,
+		DatabasePoolIdleTimeoutMs: 1000,
+	})
+	instance := NewUnleashInstance(&server)
+
+	checksum := instance.ConfigChecksum()
+	assert.False(t, checksum.Drift)
+	assert.Equal(t, server.GetAnnotations()[ConfigChecksumAnnotationKey], checksum.Checksum)
+	assert.Equal(t, checksum.Checksum, checksum.StoredChecksum)
+
+	for i, envVar := range server.Spec.ExtraEnvVars {
+		if envVar.Name == "LOG_LEVEL" {
+			server.Spec.ExtraEnvVars[i].Value = "debug"
+		}
+	}
+
+	checksum = instance.ConfigChecksum()
+	assert.True(t, checksum.Drift)
+	assert.NotEqual(t, checksum.StoredChecksum, checksum.Checksum)
+
+	instance.ServerInstance = nil
+	assert.Equal(t, &UnleashConfigChecksum{}, instance.ConfigChecksum())
+}
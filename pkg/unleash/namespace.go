@@ -0,0 +1,43 @@
+package unleash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrInstanceNamespaceUnverified is returned when bifrost is not allowed to get the instance namespace, so it can
+// not tell whether the namespace exists.
+var ErrInstanceNamespaceUnverified = errors.New("instance namespace can not be verified")
+
+func EnsureInstanceNamespace(ctx context.Context, kubeClient ctrl.Client, name string, create bool) error {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+
+	err := kubeClient.Get(ctx, ctrl.ObjectKeyFromObject(namespace), namespace)
+	if err == nil {
+		return nil
+	}
+
+	if apierrors.IsForbidden(err) {
+		return fmt.Errorf("%w: %q: %w", ErrInstanceNamespaceUnverified, name, err)
+	}
+
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get instance namespace %q: %w", name, err)
+	}
+
+	if !create {
+		return fmt.Errorf("instance namespace %q does not exist, create it or set BIFROST_UNLEASH_INSTANCE_NAMESPACE_CREATE=true", name)
+	}
+
+	if err := kubeClient.Create(ctx, namespace); err != nil {
+		return fmt.Errorf("failed to create instance namespace %q: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package unleash
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestEnsureInstanceNamespace(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("namespace exists", func(t *testing.T) {
+		kubeClient := newFakeKubeClient(t, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "unleash-ns"}})
+
+		assert.NoError(t, EnsureInstanceNamespace(ctx, kubeClient, "unleash-ns", false))
+	})
+
+	t.Run("namespace missing", func(t *testing.T) {
+		kubeClient := newFakeKubeClient(t)
+
+		err := EnsureInstanceNamespace(ctx, kubeClient, "unleash-ns", false)
+		assert.ErrorContains(t, err, `instance namespace "unleash-ns" does not exist`)
+	})
+
+	t.Run("namespace missing with create", func(t *testing.T) {
+		kubeClient := newFakeKubeClient(t)
+
+		assert.NoError(t, EnsureInstanceNamespace(ctx, kubeClient, "unleash-ns", true))
+		assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Name: "unleash-ns"}, &corev1.Namespace{}))
+	})
+	t.Run("namespace forbidden", func(t *testing.T) {
+		kubeClient := interceptor.NewClient(newFakeKubeClient(t).(ctrl.WithWatch), interceptor.Funcs{
+			Get: func(ctx context.Context, client ctrl.WithWatch, key ctrl.ObjectKey, obj ctrl.Object, opts ...ctrl.GetOption) error {
+				return apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, key.Name, errors.New("no rbac rule"))
+			},
+		})
+
+		err := EnsureInstanceNamespace(ctx, kubeClient, "unleash-ns", true)
+		assert.ErrorIs(t, err, ErrInstanceNamespaceUnverified)
+	})
+}
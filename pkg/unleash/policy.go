@@ -0,0 +1,111 @@
+package unleash
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nais/bifrost/pkg/config"
+)
+
+const (
+	PolicyOperationCreate = "create"
+	PolicyOperationUpdate = "update"
+)
+
+type PolicyEvaluator interface {
+	Evaluate(ctx context.Context, operation string, uc *UnleashConfig) error
+}
+
+type PolicyViolationError struct {
+	Reason string
+}
+
+func (e *PolicyViolationError) Error() string {
+	return fmt.Sprintf("rejected by admission policy: %s", e.Reason)
+}
+
+func NewPolicyEvaluator(c *config.Config) PolicyEvaluator {
+	if c.Unleash.AdmissionPolicyURL == "" {
+		return NoopPolicyEvaluator{}
+	}
+
+	return &OPAPolicyEvaluator{
+		url:    c.Unleash.AdmissionPolicyURL,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+type NoopPolicyEvaluator struct{}
+
+func (NoopPolicyEvaluator) Evaluate(ctx context.Context, operation string, uc *UnleashConfig) error {
+	return nil
+}
+
+// OPAPolicyEvaluator queries an OPA data API endpoint, e.g. http://localhost:8181/v1/data/bifrost/admission,
+// where the policy is expected to produce {"allow": bool, "reason": string}.
+type OPAPolicyEvaluator struct {
+	url    string
+	client *http.Client
+}
+
+type opaRequest struct {
+	Input opaInput `json:"input"`
+}
+
+type opaInput struct {
+	Operation string         `json:"operation"`
+	Instance  *UnleashConfig `json:"instance"`
+}
+
+type opaResponse struct {
+	Result *struct {
+		Allow  bool   `json:"allow"`
+		Reason string `json:"reason"`
+	} `json:"result"`
+}
+
+func (e *OPAPolicyEvaluator) Evaluate(ctx context.Context, operation string, uc *UnleashConfig) error {
+	body, err := json.Marshal(opaRequest{Input: opaInput{Operation: operation, Instance: uc}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query admission policy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from admission policy: %d", resp.StatusCode)
+	}
+
+	var result opaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode admission policy response: %w", err)
+	}
+
+	if result.Result == nil {
+		return fmt.Errorf("admission policy returned no result")
+	}
+
+	if !result.Result.Allow {
+		reason := result.Result.Reason
+		if reason == "" {
+			reason = "denied"
+		}
+		return &PolicyViolationError{Reason: reason}
+	}
+
+	return nil
+}
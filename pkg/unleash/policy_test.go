@@ -0,0 +1,69 @@
+package unleash
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newOPAServer(t *testing.T, allow bool, reason string) (*httptest.Server, *opaRequest) {
+	received := &opaRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(received))
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"result": map[string]any{"allow": allow, "reason": reason},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return server, received
+}
+
+func TestNewPolicyEvaluator(t *testing.T) {
+	assert.IsType(t, NoopPolicyEvaluator{}, NewPolicyEvaluator(&config.Config{}))
+	assert.IsType(t, &OPAPolicyEvaluator{}, NewPolicyEvaluator(&config.Config{Unleash: config.UnleashConfig{AdmissionPolicyURL: "http://opa"}}))
+}
+
+func TestOPAPolicyEvaluator(t *testing.T) {
+	ctx := context.Background()
+	uc := &UnleashConfig{Name: "my-instance", LogLevel: "debug"}
+
+	t.Run("allow", func(t *testing.T) {
+		server, received := newOPAServer(t, true, "")
+		evaluator := NewPolicyEvaluator(&config.Config{Unleash: config.UnleashConfig{AdmissionPolicyURL: server.URL}})
+
+		assert.NoError(t, evaluator.Evaluate(ctx, PolicyOperationCreate, uc))
+		assert.Equal(t, PolicyOperationCreate, received.Input.Operation)
+		assert.Equal(t, "my-instance", received.Input.Instance.Name)
+		assert.Equal(t, "debug", received.Input.Instance.LogLevel)
+	})
+
+	t.Run("deny", func(t *testing.T) {
+		server, _ := newOPAServer(t, false, "debug logging is not allowed")
+		evaluator := NewPolicyEvaluator(&config.Config{Unleash: config.UnleashConfig{AdmissionPolicyURL: server.URL}})
+
+		err := evaluator.Evaluate(ctx, PolicyOperationUpdate, uc)
+		var policyErr *PolicyViolationError
+		assert.ErrorAs(t, err, &policyErr)
+		assert.Equal(t, "debug logging is not allowed", policyErr.Reason)
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		server, _ := newOPAServer(t, true, "")
+		server.Close()
+		evaluator := NewPolicyEvaluator(&config.Config{Unleash: config.UnleashConfig{AdmissionPolicyURL: server.URL}})
+
+		err := evaluator.Evaluate(ctx, PolicyOperationCreate, uc)
+		var policyErr *PolicyViolationError
+		assert.Error(t, err)
+		assert.False(t, errors.As(err, &policyErr))
+	})
+}
@@ -0,0 +1,147 @@
+package unleash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	fqdnV1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+	"github.com/nais/bifrost/pkg/config"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reaperMinAge keeps the reaper away from resources of instances that are still being created, as the database
+// secret and FQDN policy are created before the Unleash resource.
+const reaperMinAge = 10 * time.Minute
+
+// Reaper finds FQDN network policies and database secrets in the instance namespace that no longer have a
+// matching Unleash instance, and deletes them unless running in dry-run mode.
+type Reaper struct {
+	kubeClient ctrl.Client
+	config     *config.Config
+	logger     *logrus.Logger
+	now        func() time.Time
+}
+
+func NewReaper(kubeClient ctrl.Client, config *config.Config, logger *logrus.Logger) *Reaper {
+	return &Reaper{
+		kubeClient: kubeClient,
+		config:     config,
+		logger:     logger,
+		now:        time.Now,
+	}
+}
+
+func (r *Reaper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Reap(ctx); err != nil {
+			r.logger.WithError(err).Warn("Error reaping orphaned Unleash resources")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reap returns the orphaned resources as kind/name, which are deleted unless the reaper is in dry-run mode.
+func (r *Reaper) Reap(ctx context.Context) ([]string, error) {
+	namespace := r.config.Unleash.InstanceNamespace
+	opts := &ctrl.ListOptions{Namespace: namespace}
+
+	servers := unleashv1.UnleashList{}
+	if err := r.kubeClient.List(ctx, &servers, opts); err != nil {
+		return nil, fmt.Errorf("failed to list unleash instances: %w", err)
+	}
+
+	instances := map[string]bool{}
+	for _, server := range servers.Items {
+		instances[server.Name] = true
+	}
+
+	orphans := []ctrl.Object{}
+
+	policies := fqdnV1alpha3.FQDNNetworkPolicyList{}
+	if err := r.kubeClient.List(ctx, &policies, opts); err != nil {
+		return nil, fmt.Errorf("failed to list fqdn network policies: %w", err)
+	}
+
+	for i := range policies.Items {
+		policy := &policies.Items[i]
+		name, ok := strings.CutSuffix(policy.Name, "-fqdn")
+		if !ok || policy.Spec.PodSelector.MatchLabels["app.kubernetes.io/part-of"] != "unleasherator" {
+			continue
+		}
+		if !instances[name] && r.oldEnough(policy) {
+			orphans = append(orphans, policy)
+		}
+	}
+
+	secrets := corev1.SecretList{}
+	if err := r.kubeClient.List(ctx, &secrets, opts); err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if !isDatabaseUserSecret(secret) || isArchivedSecret(secret) || secret.Name == r.config.Unleash.TeamsApiSecretName {
+			continue
+		}
+		if !instances[secret.Name] && r.oldEnough(secret) {
+			orphans = append(orphans, secret)
+		}
+	}
+
+	dryRun := r.config.Unleash.ReaperDryRun
+	names := make([]string, 0, len(orphans))
+	errs := []error{}
+
+	for _, orphan := range orphans {
+		name := fmt.Sprintf("%s/%s", orphanKind(orphan), orphan.GetName())
+		names = append(names, name)
+
+		log := r.logger.WithField("resource", name).WithField("dryRun", dryRun)
+		if dryRun {
+			log.Info("Found orphaned Unleash resource")
+			continue
+		}
+
+		log.Info("Deleting orphaned Unleash resource")
+		if err := r.kubeClient.Delete(ctx, orphan); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete %s: %w", name, err))
+		}
+	}
+
+	return names, errors.Join(errs...)
+}
+
+func (r *Reaper) oldEnough(obj ctrl.Object) bool {
+	return r.now().Sub(obj.GetCreationTimestamp().Time) >= reaperMinAge
+}
+
+func isDatabaseUserSecret(secret *corev1.Secret) bool {
+	_, hasUser := secret.Data["POSTGRES_USER"]
+	_, hasPassword := secret.Data["POSTGRES_PASSWORD"]
+	return hasUser && hasPassword && string(secret.Data["POSTGRES_DB"]) == secret.Name
+}
+
+func orphanKind(obj ctrl.Object) string {
+	switch obj.(type) {
+	case *fqdnV1alpha3.FQDNNetworkPolicy:
+		return "FQDNNetworkPolicy"
+	case *corev1.Secret:
+		return "Secret"
+	default:
+		return "Unknown"
+	}
+}
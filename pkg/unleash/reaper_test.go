@@ -0,0 +1,91 @@
+package unleash
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	fqdnV1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReaper(t *testing.T) {
+	ctx := context.Background()
+
+	objects := func() []ctrl.Object {
+		c := newTestConfig()
+		server := UnleashDefinition(c, &UnleashConfig{Name: "team-a"})
+		fqdnA := FQDNNetworkPolicyDefinition("team-a", "unleash-ns", nil, nil)
+		fqdnB := FQDNNetworkPolicyDefinition("team-b", "unleash-ns", nil, nil)
+
+		databaseSecret := func(name string) *corev1.Secret {
+			return &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "unleash-ns"},
+				Data: map[string][]byte{
+					"POSTGRES_USER":     []byte(name),
+					"POSTGRES_PASSWORD": []byte("password"),
+					"POSTGRES_DB":       []byte(name),
+				},
+			}
+		}
+
+		return []ctrl.Object{
+			&server,
+			&fqdnA,
+			&fqdnB,
+			databaseSecret("team-a"),
+			databaseSecret("team-b"),
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "teams-api-secret", Namespace: "unleash-ns"},
+				Data:       map[string][]byte{"token": []byte("secret-token")},
+			},
+		}
+	}
+
+	t.Run("dry run only reports orphans", func(t *testing.T) {
+		c := newTestConfig()
+		c.Unleash.ReaperDryRun = true
+		kubeClient := newFakeKubeClient(t, objects()...)
+
+		orphans, err := NewReaper(kubeClient, c, logrus.New()).Reap(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"FQDNNetworkPolicy/team-b-fqdn", "Secret/team-b"}, orphans)
+
+		assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "team-b-fqdn"}, &fqdnV1alpha3.FQDNNetworkPolicy{}))
+		assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "team-b"}, &corev1.Secret{}))
+	})
+
+	t.Run("deletes orphans", func(t *testing.T) {
+		c := newTestConfig()
+		kubeClient := newFakeKubeClient(t, objects()...)
+
+		orphans, err := NewReaper(kubeClient, c, logrus.New()).Reap(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"FQDNNetworkPolicy/team-b-fqdn", "Secret/team-b"}, orphans)
+
+		assert.Error(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "team-b-fqdn"}, &fqdnV1alpha3.FQDNNetworkPolicy{}))
+		assert.Error(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "team-b"}, &corev1.Secret{}))
+
+		assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "team-a"}, &unleashv1.Unleash{}))
+		assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "team-a-fqdn"}, &fqdnV1alpha3.FQDNNetworkPolicy{}))
+		assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "team-a"}, &corev1.Secret{}))
+		assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "teams-api-secret"}, &corev1.Secret{}))
+	})
+
+	t.Run("skips recently created resources", func(t *testing.T) {
+		c := newTestConfig()
+		kubeClient := newFakeKubeClient(t, objects()...)
+
+		reaper := NewReaper(kubeClient, c, logrus.New())
+		reaper.now = func() time.Time { return time.Time{}.Add(time.Minute) }
+
+		orphans, err := reaper.Reap(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, orphans)
+	})
+}
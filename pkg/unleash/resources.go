@@ -1,6 +1,10 @@
 package unleash
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
 	"strconv"
@@ -17,6 +21,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
@@ -25,6 +30,7 @@ const (
 	UnleashRequestCPU         = "100m"
 	UnleashRequestMemory      = "128Mi"
 	UnleashLimitMemory        = "256Mi"
+	SqlProxyContainerName     = "sql-proxy"
 	SqlProxyRequestCPU        = "10m"
 	SqlProxyRequestMemory     = "100Mi"
 	SqlProxyLimitMemory       = "100Mi"
@@ -33,8 +39,78 @@ const (
 	LogLevel                  = "warn"
 )
 
+const (
+	EnvironmentLabelKey               = "bifrost.nais.io/environment"
+	AllowedEgressFQDNsAnnotationKey   = "bifrost.nais.io/allowed-egress-fqdns"
+	ConfigChecksumAnnotationKey       = "bifrost.nais.io/config-checksum"
+	CredentialsRotatedAtAnnotationKey = "bifrost.nais.io/credentials-rotated-at"
+	SQLInstanceAnnotationKey          = "bifrost.nais.io/sql-instance"
+)
+
 var FederationAllowedClusters = []string{"dev-gcp", "prod-gcp"}
 
+// ReservedMetadataPrefixes are label and annotation key prefixes owned by Bifrost and the operator, which users
+// can not set themselves.
+var ReservedMetadataPrefixes = []string{"app.kubernetes.io/", "bifrost.nais.io/"}
+
+var ManagedEnvVars = []string{
+	"GOOGLE_IAP_AUDIENCE",
+	"TEAMS_API_URL",
+	"TEAMS_API_TOKEN",
+	"TEAMS_ALLOWED_TEAMS",
+	"LOG_LEVEL",
+	"DATABASE_POOL_MAX",
+	"DATABASE_POOL_IDLE_TIMEOUT_MS",
+}
+
+var DefaultEgressFQDNs = []string{"sqladmin.googleapis.com", "www.gstatic.com", "hooks.slack.com", "console.nav.cloud.nais.io"}
+
+func ResourceLabels(c *config.Config) map[string]string {
+	if c.Unleash.Environment == "" {
+		return nil
+	}
+
+	return map[string]string{
+		EnvironmentLabelKey: c.Unleash.Environment,
+	}
+}
+
+func isReservedMetadataKey(key string) bool {
+	for _, prefix := range ReservedMetadataPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// userMetadata returns the labels or annotations not owned by Bifrost or the operator.
+func userMetadata(metadata map[string]string) map[string]string {
+	var user map[string]string
+	for key, value := range metadata {
+		if isReservedMetadataKey(key) {
+			continue
+		}
+		if user == nil {
+			user = map[string]string{}
+		}
+		user[key] = value
+	}
+	return user
+}
+
+// mergeMetadata returns the user metadata with the system metadata applied on top.
+func mergeMetadata(user, system map[string]string) map[string]string {
+	merged := map[string]string{}
+	for key, value := range user {
+		merged[key] = value
+	}
+	for key, value := range system {
+		merged[key] = value
+	}
+	return merged
+}
+
 func boolRef(b bool) *bool {
 	boolVar := b
 	return &boolVar
@@ -45,13 +121,34 @@ func int64Ref(i int64) *int64 {
 	return &intvar
 }
 
-func FQDNNetworkPolicyDefinition(name string, kubeNamespace string) fqdnV1alpha3.FQDNNetworkPolicy {
+// egressFQDNs returns the default egress FQDNs followed by any extra FQDNs not already in the list.
+func egressFQDNs(extraFQDNs []string) []string {
+	fqdns := append([]string{}, DefaultEgressFQDNs...)
+	seen := make(map[string]bool, len(fqdns))
+	for _, fqdn := range fqdns {
+		seen[fqdn] = true
+	}
+
+	for _, fqdn := range extraFQDNs {
+		fqdn = strings.ToLower(strings.TrimSpace(fqdn))
+		if fqdn == "" || seen[fqdn] {
+			continue
+		}
+		seen[fqdn] = true
+		fqdns = append(fqdns, fqdn)
+	}
+
+	return fqdns
+}
+
+func FQDNNetworkPolicyDefinition(name string, kubeNamespace string, labels map[string]string, extraFQDNs []string) fqdnV1alpha3.FQDNNetworkPolicy {
 	protocolTCP := corev1.ProtocolTCP
 
 	return fqdnV1alpha3.FQDNNetworkPolicy{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      fmt.Sprintf("%s-fqdn", name),
 			Namespace: kubeNamespace,
+			Labels:    labels,
 		},
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "FQDNNetworkPolicy",
@@ -76,7 +173,7 @@ func FQDNNetworkPolicyDefinition(name string, kubeNamespace string) fqdnV1alpha3
 					},
 					To: []fqdnV1alpha3.FQDNNetworkPolicyPeer{
 						{
-							FQDNs: []string{"sqladmin.googleapis.com", "www.gstatic.com", "hooks.slack.com", "console.nav.cloud.nais.io"},
+							FQDNs: egressFQDNs(extraFQDNs),
 						},
 					},
 				},
@@ -102,12 +199,81 @@ func FQDNNetworkPolicyDefinition(name string, kubeNamespace string) fqdnV1alpha3
 	}
 }
 
-func customImageForVersion(customVersion string) string {
-	return fmt.Sprintf("%s%s:%s", UnleashCustomImageRepo, UnleashCustomImageName, customVersion)
+func quantityOrDefault(value, defaultValue string) resource.Quantity {
+	if value == "" {
+		value = defaultValue
+	}
+	return resource.MustParse(value)
+}
+
+// resourceOverride returns the quantity set for name in list, or an empty string when it is unset or the default.
+func resourceOverride(list corev1.ResourceList, name corev1.ResourceName, defaultValue string) string {
+	quantity, ok := list[name]
+	if !ok || quantity.Cmp(resource.MustParse(defaultValue)) == 0 {
+		return ""
+	}
+	return quantity.String()
+}
+
+func sqlProxyResources(c *config.Config) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    quantityOrDefault(c.Unleash.SqlProxyCPURequest, SqlProxyRequestCPU),
+			corev1.ResourceMemory: quantityOrDefault(c.Unleash.SqlProxyMemoryRequest, SqlProxyRequestMemory),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: quantityOrDefault(c.Unleash.SqlProxyMemoryLimit, SqlProxyLimitMemory),
+		},
+	}
+}
+
+func customImageForVersion(c *config.Config, customVersion string) string {
+	repo := c.Unleash.CustomImageRepo
+	if repo == "" {
+		repo = UnleashCustomImageRepo
+	}
+
+	name := c.Unleash.CustomImageName
+	if name == "" {
+		name = UnleashCustomImageName
+	}
+
+	return fmt.Sprintf("%s%s:%s", repo, name, customVersion)
 }
 
 func versionFromImage(image string) string {
-	return strings.Split(image, ":")[1]
+	return image[strings.LastIndex(image, ":")+1:]
+}
+
+func sqlProxyImage(server *unleashv1.Unleash) string {
+	for _, container := range server.Spec.ExtraContainers {
+		if container.Name == SqlProxyContainerName {
+			return container.Image
+		}
+	}
+	return ""
+}
+
+func isManagedEnvVar(name string) bool {
+	for _, managed := range ManagedEnvVars {
+		if managed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// splitServerEnvVars returns the names of the Bifrost managed and the extra env vars set on the server.
+func splitServerEnvVars(server *unleashv1.Unleash) (managed []string, extra []string) {
+	managed, extra = []string{}, []string{}
+	for _, envVar := range server.Spec.ExtraEnvVars {
+		if isManagedEnvVar(envVar.Name) {
+			managed = append(managed, envVar.Name)
+		} else {
+			extra = append(extra, envVar.Name)
+		}
+	}
+	return managed, extra
 }
 
 func getServerEnvVar(server *unleashv1.Unleash, name, defaultValue string, returnDefault bool) string {
@@ -124,16 +290,25 @@ func getServerEnvVar(server *unleashv1.Unleash, name, defaultValue string, retur
 }
 
 type UnleashConfig struct {
-	Name                      string `json:"name,omitempty" form:"name" validate:"required,hostname"`
-	CustomVersion             string `json:"custom-version,omitempty" form:"custom-version" validate:"omitempty"`
-	EnableFederation          bool   `json:"enable-federation,omitempty" form:"enable-federation,default=true"`
-	FederationNonce           string `json:"-" form:"-" validate:"required"`
-	AllowedTeams              string `json:"allowed-teams,omitempty" form:"allowed-teams" validate:"omitempty"`
-	AllowedNamespaces         string `json:"allowed-namespaces,omitempty" form:"allowed-namespaces" validate:"omitempty"`
-	AllowedClusters           string `json:"allowed-clusters,omitempty" form:"allowed-clusters" validate:"omitempty"`
-	LogLevel                  string `json:"log-level,omitempty" form:"loglevel,default=warn" validate:"required,oneof=debug info warn error fatal panic"`
-	DatabasePoolMax           int    `json:"database-pool-max,omitempty" form:"database-pool-max,default=3" validate:"required,min=1,max=10"`
-	DatabasePoolIdleTimeoutMs int    `json:"database-pool-idle-timeout-ms,omitempty" form:"database-pool-idle-timeout-ms,default=1000" validate:"required"`
+	Name                      string            `json:"name,omitempty" form:"name" validate:"required,hostname"`
+	CustomVersion             string            `json:"custom-version,omitempty" form:"custom-version" validate:"omitempty"`
+	EnableFederation          bool              `json:"enable-federation,omitempty" form:"enable-federation,default=true"`
+	FederationNonce           string            `json:"-" form:"-" validate:"required"`
+	AllowedTeams              string            `json:"allowed-teams,omitempty" form:"allowed-teams" validate:"omitempty"`
+	AllowedNamespaces         string            `json:"allowed-namespaces,omitempty" form:"allowed-namespaces" validate:"omitempty"`
+	AllowedClusters           string            `json:"allowed-clusters,omitempty" form:"allowed-clusters" validate:"omitempty"`
+	LogLevel                  string            `json:"log-level,omitempty" form:"loglevel,default=warn" validate:"required,oneof=debug info warn error fatal panic"`
+	DatabasePoolMax           int               `json:"database-pool-max,omitempty" form:"database-pool-max,default=3" validate:"required,min=1,max=10"`
+	DatabasePoolIdleTimeoutMs int               `json:"database-pool-idle-timeout-ms,omitempty" form:"database-pool-idle-timeout-ms,default=1000" validate:"required"`
+	AllowedEgressFQDNs        string            `json:"allowed-egress-fqdns,omitempty" form:"allowed-egress-fqdns" validate:"omitempty"`
+	Labels                    map[string]string `json:"labels,omitempty" form:"-"`
+	Annotations               map[string]string `json:"annotations,omitempty" form:"-"`
+	DatabaseCharset           string            `json:"database-charset,omitempty" form:"-" validate:"omitempty,oneof=UTF8 LATIN1 SQL_ASCII"`
+	DatabaseCollation         string            `json:"database-collation,omitempty" form:"-" validate:"omitempty,oneof=C POSIX C.UTF8 en_US.UTF8 nb_NO.UTF8"`
+	CPURequest                string            `json:"cpu-request,omitempty" form:"-"`
+	MemoryRequest             string            `json:"memory-request,omitempty" form:"-"`
+	MemoryLimit               string            `json:"memory-limit,omitempty" form:"-"`
+	SQLInstanceID             string            `json:"sql-instance,omitempty" form:"-"`
 }
 
 func (uc *UnleashConfig) SetDefaultValues(unleashVersions []github.UnleashVersion) {
@@ -173,9 +348,131 @@ func (uc *UnleashConfig) MergeTeamsAndNamespaces() {
 	uc.AllowedNamespaces = strings.Join(result, ",")
 }
 
+// Validate checks the config and returns all failures joined, with each failure that is not reported by the
+// struct validator wrapped in a FieldError.
 func (uc *UnleashConfig) Validate() error {
+	errs := []error{}
+
 	validate := validator.New(validator.WithRequiredStructEnabled())
-	return validate.Struct(uc)
+	if err := validate.Struct(uc); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, fqdn := range uc.ExtraEgressFQDNs() {
+		if err := validate.Var(fqdn, "fqdn"); err != nil {
+			errs = append(errs, &FieldError{Field: "allowed-egress-fqdns", Err: fmt.Errorf("invalid egress FQDN %q", fqdn)})
+		}
+	}
+
+	resources := []struct{ name, value string }{
+		{"cpu-request", uc.CPURequest},
+		{"memory-request", uc.MemoryRequest},
+		{"memory-limit", uc.MemoryLimit},
+	}
+	validResources := true
+	for _, r := range resources {
+		if r.value == "" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(r.value); err != nil {
+			errs = append(errs, &FieldError{Field: r.name, Err: fmt.Errorf("invalid %s %q: %w", r.name, r.value, err)})
+			validResources = false
+		}
+	}
+
+	// The API server rejects a Deployment requesting more memory than its limit, overrides or defaults alike
+	if validResources {
+		memoryRequest := quantityOrDefault(uc.MemoryRequest, UnleashRequestMemory)
+		memoryLimit := quantityOrDefault(uc.MemoryLimit, UnleashLimitMemory)
+		if memoryRequest.Cmp(memoryLimit) > 0 {
+			errs = append(errs, &FieldError{Field: "memory-request", Err: fmt.Errorf("memory-request %s is larger than memory-limit %s", memoryRequest.String(), memoryLimit.String())})
+		}
+	}
+
+	for key, value := range uc.Labels {
+		if isReservedMetadataKey(key) {
+			errs = append(errs, &FieldError{Field: "labels", Err: fmt.Errorf("label %q is reserved", key)})
+		} else if problems := validation.IsQualifiedName(key); len(problems) > 0 {
+			errs = append(errs, &FieldError{Field: "labels", Err: fmt.Errorf("invalid label key %q: %s", key, strings.Join(problems, ", "))})
+		} else if problems := validation.IsValidLabelValue(value); len(problems) > 0 {
+			errs = append(errs, &FieldError{Field: "labels", Err: fmt.Errorf("invalid value for label %q: %s", key, strings.Join(problems, ", "))})
+		}
+	}
+
+	for key := range uc.Annotations {
+		if isReservedMetadataKey(key) {
+			errs = append(errs, &FieldError{Field: "annotations", Err: fmt.Errorf("annotation %q is reserved", key)})
+		} else if problems := validation.IsQualifiedName(key); len(problems) > 0 {
+			errs = append(errs, &FieldError{Field: "annotations", Err: fmt.Errorf("invalid annotation key %q: %s", key, strings.Join(problems, ", "))})
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (uc *UnleashConfig) ValidateDatabasePoolIdleTimeout(min, max int) error {
+	if uc.DatabasePoolIdleTimeoutMs < min || uc.DatabasePoolIdleTimeoutMs > max {
+		return &FieldError{Field: "database-pool-idle-timeout-ms", Err: fmt.Errorf("%w: %d ms is outside the allowed range %d-%d ms", ErrInvalidDatabasePoolTimeout, uc.DatabasePoolIdleTimeoutMs, min, max)}
+	}
+
+	return nil
+}
+
+// ValidateFederationNonce rejects nonces that are shorter than minLength or contain other characters than
+// letters and digits.
+func (uc *UnleashConfig) ValidateFederationNonce(minLength int) error {
+	if len(uc.FederationNonce) < minLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakFederationNonce, minLength)
+	}
+
+	for _, r := range uc.FederationNonce {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return fmt.Errorf("%w: must only contain letters and digits", ErrWeakFederationNonce)
+		}
+	}
+
+	return nil
+}
+
+func ingressHost(name, suffix string) string {
+	return fmt.Sprintf("%s-%s", name, suffix)
+}
+
+// ValidateIngressHosts checks that the ingress hosts generated from the instance name fit within DNS length limits.
+func (uc *UnleashConfig) ValidateIngressHosts(suffixes ...string) error {
+	for _, suffix := range suffixes {
+		host := ingressHost(uc.Name, suffix)
+		if len(host) > validation.DNS1123SubdomainMaxLength {
+			return &FieldError{Field: "name", Err: fmt.Errorf("ingress host %q is %d characters, exceeding the limit of %d", host, len(host), validation.DNS1123SubdomainMaxLength)}
+		}
+
+		label := strings.SplitN(host, ".", 2)[0]
+		if len(label) > validation.DNS1123LabelMaxLength {
+			return &FieldError{Field: "name", Err: fmt.Errorf("ingress host %q has a first label of %d characters, exceeding the limit of %d", host, len(label), validation.DNS1123LabelMaxLength)}
+		}
+	}
+
+	return nil
+}
+
+// Checksum returns a stable sha256 checksum of the config, excluding the federation nonce.
+func (uc *UnleashConfig) Checksum() string {
+	data, _ := json.Marshal(uc)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ExtraEgressFQDNs returns the normalized additional egress FQDNs, excluding the defaults.
+func (uc *UnleashConfig) ExtraEgressFQDNs() []string {
+	fqdns := egressFQDNs(utils.SplitNoEmpty(uc.AllowedEgressFQDNs, ","))
+	return fqdns[len(DefaultEgressFQDNs):]
+}
+
+// PolicyEgressFQDNs returns the additional FQDNs for the instance network policy, both the ones configured
+// for all instances and the ones requested for this instance.
+func PolicyEgressFQDNs(c *config.Config, uc *UnleashConfig) []string {
+	fqdns := egressFQDNs(append(utils.SplitNoEmpty(c.Unleash.ExtraEgressFQDNs, ","), uc.ExtraEgressFQDNs()...))
+	return fqdns[len(DefaultEgressFQDNs):]
 }
 
 func UnleashVariables(server *unleashv1.Unleash, returnDefaults bool) *UnleashConfig {
@@ -193,8 +490,15 @@ func UnleashVariables(server *unleashv1.Unleash, returnDefaults bool) *UnleashCo
 	uc.DatabasePoolMax, _ = strconv.Atoi(getServerEnvVar(server, "DATABASE_POOL_MAX", DatabasePoolMax, returnDefaults))
 	uc.DatabasePoolIdleTimeoutMs, _ = strconv.Atoi(getServerEnvVar(server, "DATABASE_POOL_IDLE_TIMEOUT_MS", DatabasePoolIdleTimeoutMs, returnDefaults))
 	uc.EnableFederation = server.Spec.Federation.Enabled
+	uc.AllowedEgressFQDNs = server.GetAnnotations()[AllowedEgressFQDNsAnnotationKey]
+	uc.SQLInstanceID = server.GetAnnotations()[SQLInstanceAnnotationKey]
+	uc.Labels = userMetadata(server.GetLabels())
+	uc.Annotations = userMetadata(server.GetAnnotations())
 	uc.AllowedNamespaces = utils.JoinNoEmpty(server.Spec.Federation.Namespaces, ",")
 	uc.AllowedClusters = utils.JoinNoEmpty(server.Spec.Federation.Clusters, ",")
+	uc.CPURequest = resourceOverride(server.Spec.Resources.Requests, corev1.ResourceCPU, UnleashRequestCPU)
+	uc.MemoryRequest = resourceOverride(server.Spec.Resources.Requests, corev1.ResourceMemory, UnleashRequestMemory)
+	uc.MemoryLimit = resourceOverride(server.Spec.Resources.Limits, corev1.ResourceMemory, UnleashLimitMemory)
 
 	if uc.EnableFederation && len(uc.AllowedClusters) == 0 {
 		uc.AllowedNamespaces = utils.JoinNoEmpty(FederationAllowedClusters, ",")
@@ -209,6 +513,9 @@ func UnleashDefinition(c *config.Config, uc *UnleashConfig) unleashv1.Unleash {
 
 	googleIapAudience := c.GoogleIAPAudience()
 
+	// Unknown SQL instances are rejected by the service before a definition is created
+	sqlInstance, _ := sqlInstanceByID(c, uc.SQLInstanceID)
+
 	federationNonce := uc.FederationNonce
 	if federationNonce == "" {
 		federationNonce = utils.RandomString(8)
@@ -222,6 +529,7 @@ func UnleashDefinition(c *config.Config, uc *UnleashConfig) unleashv1.Unleash {
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      uc.Name,
 			Namespace: c.Unleash.InstanceNamespace,
+			Labels:    mergeMetadata(uc.Labels, ResourceLabels(c)),
 		},
 		Spec: unleashv1.UnleashSpec{
 			Size: 1,
@@ -236,13 +544,13 @@ func UnleashDefinition(c *config.Config, uc *UnleashConfig) unleashv1.Unleash {
 			},
 			WebIngress: unleashv1.UnleashIngressConfig{
 				Enabled: true,
-				Host:    fmt.Sprintf("%s-%s", uc.Name, c.Unleash.InstanceWebIngressHost),
+				Host:    ingressHost(uc.Name, c.Unleash.InstanceWebIngressHost),
 				Path:    "/",
 				Class:   c.Unleash.InstanceWebIngressClass,
 			},
 			ApiIngress: unleashv1.UnleashIngressConfig{
 				Enabled: true,
-				Host:    fmt.Sprintf("%s-%s", uc.Name, c.Unleash.InstanceAPIIngressHost),
+				Host:    ingressHost(uc.Name, c.Unleash.InstanceAPIIngressHost),
 				// Allow access to /health endpoint, change to /api when https://github.com/nais/unleasherator/issues/100 is resolved
 				Path:  "/",
 				Class: c.Unleash.InstanceAPIIngressClass,
@@ -258,7 +566,7 @@ func UnleashDefinition(c *config.Config, uc *UnleashConfig) unleashv1.Unleash {
 						}},
 						To: []networkingv1.NetworkPolicyPeer{{
 							IPBlock: &networkingv1.IPBlock{
-								CIDR: fmt.Sprintf("%s/32", c.Unleash.SQLInstanceAddress),
+								CIDR: fmt.Sprintf("%s/32", sqlInstance.Address),
 							},
 						}},
 					},
@@ -300,14 +608,14 @@ func UnleashDefinition(c *config.Config, uc *UnleashConfig) unleashv1.Unleash {
 				Value: fmt.Sprintf("%d", uc.DatabasePoolIdleTimeoutMs),
 			}},
 			ExtraContainers: []corev1.Container{{
-				Name:  "sql-proxy",
+				Name:  SqlProxyContainerName,
 				Image: c.CloudConnectorProxy,
 				Args: []string{
 					"--structured-logs",
 					"--port=5432",
 					fmt.Sprintf("%s:%s:%s", c.Google.ProjectID,
-						c.Unleash.SQLInstanceRegion,
-						c.Unleash.SQLInstanceID),
+						sqlInstance.Region,
+						sqlInstance.ID),
 				},
 				SecurityContext: &corev1.SecurityContext{
 					Capabilities: &corev1.Capabilities{
@@ -318,32 +626,36 @@ func UnleashDefinition(c *config.Config, uc *UnleashConfig) unleashv1.Unleash {
 					RunAsNonRoot:             boolRef(true),
 					AllowPrivilegeEscalation: boolRef(false),
 				},
-				Resources: corev1.ResourceRequirements{
-					Requests: corev1.ResourceList{
-						corev1.ResourceCPU:    resource.MustParse(SqlProxyRequestCPU),
-						corev1.ResourceMemory: resource.MustParse(SqlProxyRequestMemory),
-					},
-					Limits: corev1.ResourceList{
-						corev1.ResourceMemory: resource.MustParse(SqlProxyLimitMemory),
-					},
-				},
+				Resources: sqlProxyResources(c),
 			}},
 			ExistingServiceAccountName: c.Unleash.InstanceServiceaccount,
 			Resources: corev1.ResourceRequirements{
 				Requests: corev1.ResourceList{
-					corev1.ResourceCPU:    resource.MustParse(UnleashRequestCPU),
-					corev1.ResourceMemory: resource.MustParse(UnleashRequestMemory),
+					corev1.ResourceCPU:    quantityOrDefault(uc.CPURequest, UnleashRequestCPU),
+					corev1.ResourceMemory: quantityOrDefault(uc.MemoryRequest, UnleashRequestMemory),
 				},
 				Limits: corev1.ResourceList{
-					corev1.ResourceMemory: resource.MustParse(UnleashLimitMemory),
+					corev1.ResourceMemory: quantityOrDefault(uc.MemoryLimit, UnleashLimitMemory),
 				},
 			},
 		},
 	}
 
 	if uc.CustomVersion != "" {
-		server.Spec.CustomImage = customImageForVersion(uc.CustomVersion)
+		server.Spec.CustomImage = customImageForVersion(c, uc.CustomVersion)
 	}
 
+	annotations := mergeMetadata(uc.Annotations, nil)
+	if extraFQDNs := uc.ExtraEgressFQDNs(); len(extraFQDNs) > 0 {
+		annotations[AllowedEgressFQDNsAnnotationKey] = strings.Join(extraFQDNs, ",")
+	}
+	if uc.SQLInstanceID != "" {
+		annotations[SQLInstanceAnnotationKey] = uc.SQLInstanceID
+	}
+	server.SetAnnotations(annotations)
+
+	// The checksum is computed from the config as read back from the definition, so it can be recomputed on read
+	annotations[ConfigChecksumAnnotationKey] = UnleashVariables(&server, false).Checksum()
+
 	return server
 }
@@ -1,7 +1,10 @@
 package unleash
 
 import (
+	"encoding/json"
+	"errors"
 	"strconv"
+	"strings"
 	"testing"
 
 	fqdnV1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
@@ -82,7 +85,15 @@ func TestCustomImageForVersion(t *testing.T) {
 	customVersion := "1.2.3"
 	expectedImage := "europe-north1-docker.pkg.dev/nais-io/nais/images/unleash-v4:1.2.3"
 
-	assert.Equal(t, expectedImage, customImageForVersion(customVersion))
+	assert.Equal(t, expectedImage, customImageForVersion(&config.Config{}, customVersion))
+
+	c := &config.Config{Unleash: config.UnleashConfig{
+		CustomImageRepo: "registry.example.com:5000/unleash/",
+		CustomImageName: "unleash-server",
+	}}
+	image := customImageForVersion(c, customVersion)
+	assert.Equal(t, "registry.example.com:5000/unleash/unleash-server:1.2.3", image)
+	assert.Equal(t, customVersion, versionFromImage(image))
 }
 
 func TestUnleashVariables(t *testing.T) {
@@ -129,7 +140,7 @@ func TestFQDNNetworkPolicySpec(t *testing.T) {
 
 	protocolTCP := corev1.ProtocolTCP
 
-	a := FQDNNetworkPolicyDefinition(teamName, kubeNamespace)
+	a := FQDNNetworkPolicyDefinition(teamName, kubeNamespace, nil, nil)
 	b := fqdnV1alpha3.FQDNNetworkPolicy{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "FQDNNetworkPolicy",
@@ -479,3 +490,376 @@ func TestSetDefaultValues(t *testing.T) {
 	assert.Equal(t, DatabasePoolIdleTimeoutMs, strconv.Itoa(uc.DatabasePoolIdleTimeoutMs))
 	assert.Equal(t, "v5.10.2-20240329-070801-0180a96", uc.CustomVersion)
 }
+
+func TestExtraEgressFQDNs(t *testing.T) {
+	uc := &UnleashConfig{AllowedEgressFQDNs: " hooks.example.com,Hooks.Example.com,hooks.slack.com,,api.example.com"}
+	assert.Equal(t, []string{"hooks.example.com", "api.example.com"}, uc.ExtraEgressFQDNs())
+
+	uc = &UnleashConfig{}
+	assert.Empty(t, uc.ExtraEgressFQDNs())
+
+	fqdn := FQDNNetworkPolicyDefinition("my-instance", "my-namespace", nil, []string{"hooks.example.com", "www.gstatic.com"})
+	assert.Equal(t, append(append([]string{}, DefaultEgressFQDNs...), "hooks.example.com"), fqdn.Spec.Egress[0].To[0].FQDNs)
+}
+
+func TestUnleashConfigValidateEgressFQDNs(t *testing.T) {
+	uc := &UnleashConfig{
+		Name:                      "my-instance",
+		FederationNonce:           "abc123",
+		LogLevel:                  "warn",
+		DatabasePoolMax:           3,
+		DatabasePoolIdleTimeoutMs: 1000,
+		AllowedEgressFQDNs:        "hooks.example.com",
+	}
+	assert.NoError(t, uc.Validate())
+
+	uc.AllowedEgressFQDNs = "hooks.example.com,https://not-a-hostname/"
+	assert.EqualError(t, uc.Validate(), `invalid egress FQDN "https://not-a-hostname/"`)
+}
+
+func TestUnleashConfigValidateDatabaseFlags(t *testing.T) {
+	uc := &UnleashConfig{
+		Name:                      "my-instance",
+		FederationNonce:           "abc123",
+		LogLevel:                  "warn",
+		DatabasePoolMax:           3,
+		DatabasePoolIdleTimeoutMs: 1000,
+		DatabaseCharset:           "UTF8",
+		DatabaseCollation:         "en_US.UTF8",
+	}
+	assert.NoError(t, uc.Validate())
+
+	uc.DatabaseCharset = "EBCDIC"
+	assert.ErrorContains(t, uc.Validate(), "DatabaseCharset")
+
+	uc.DatabaseCharset = ""
+	uc.DatabaseCollation = "tr_TR.UTF8"
+	assert.ErrorContains(t, uc.Validate(), "DatabaseCollation")
+}
+
+func TestUnleashConfigValidateDatabasePoolIdleTimeout(t *testing.T) {
+	tests := []struct {
+		timeout int
+		valid   bool
+	}{
+		{0, false},
+		{99, false},
+		{100, true},
+		{1000, true},
+		{60000, true},
+		{60001, false},
+	}
+
+	for _, tt := range tests {
+		uc := &UnleashConfig{DatabasePoolIdleTimeoutMs: tt.timeout}
+		err := uc.ValidateDatabasePoolIdleTimeout(100, 60000)
+		if tt.valid {
+			assert.NoError(t, err, "timeout %d", tt.timeout)
+		} else {
+			assert.ErrorIs(t, err, ErrInvalidDatabasePoolTimeout, "timeout %d", tt.timeout)
+		}
+	}
+}
+
+func TestUnleashDefinitionEgressFQDNsAnnotation(t *testing.T) {
+	c := &config.Config{}
+
+	server := UnleashDefinition(c, &UnleashConfig{Name: "my-instance", AllowedEgressFQDNs: "hooks.example.com,hooks.slack.com"})
+	assert.Equal(t, "hooks.example.com", server.GetAnnotations()[AllowedEgressFQDNsAnnotationKey])
+	assert.Equal(t, "hooks.example.com", UnleashVariables(&server, false).AllowedEgressFQDNs)
+
+	server = UnleashDefinition(c, &UnleashConfig{Name: "my-instance"})
+	assert.NotContains(t, server.GetAnnotations(), AllowedEgressFQDNsAnnotationKey)
+}
+
+func TestUnleashConfigChecksum(t *testing.T) {
+	a := &UnleashConfig{Name: "my-instance", LogLevel: "warn", DatabasePoolMax: 3, FederationNonce: "abc123"}
+	b := &UnleashConfig{Name: "my-instance", LogLevel: "warn", DatabasePoolMax: 3, FederationNonce: "def456"}
+	assert.Equal(t, a.Checksum(), b.Checksum())
+	assert.Len(t, a.Checksum(), 64)
+
+	b.LogLevel = "debug"
+	assert.NotEqual(t, a.Checksum(), b.Checksum())
+
+	c := &config.Config{}
+	serverA := UnleashDefinition(c, a)
+	serverB := UnleashDefinition(c, &UnleashConfig{Name: "my-instance", LogLevel: "warn", DatabasePoolMax: 3})
+	assert.NotEmpty(t, serverA.GetAnnotations()[ConfigChecksumAnnotationKey])
+	assert.Equal(t, serverA.GetAnnotations()[ConfigChecksumAnnotationKey], serverB.GetAnnotations()[ConfigChecksumAnnotationKey])
+}
+
+func TestUnleashDefinitionSqlProxyResources(t *testing.T) {
+	uc := &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"}
+
+	defaults := UnleashDefinition(&config.Config{}, uc)
+	explicit := UnleashDefinition(&config.Config{Unleash: config.UnleashConfig{
+		SqlProxyCPURequest:    SqlProxyRequestCPU,
+		SqlProxyMemoryRequest: SqlProxyRequestMemory,
+		SqlProxyMemoryLimit:   SqlProxyLimitMemory,
+	}}, uc)
+	assert.True(t, cmp.Equal(defaults, explicit), cmp.Diff(defaults, explicit))
+
+	custom := UnleashDefinition(&config.Config{Unleash: config.UnleashConfig{
+		SqlProxyCPURequest:    "250m",
+		SqlProxyMemoryRequest: "256Mi",
+		SqlProxyMemoryLimit:   "512Mi",
+	}}, uc)
+	resources := custom.Spec.ExtraContainers[0].Resources
+	assert.Equal(t, resource.MustParse("250m"), resources.Requests[corev1.ResourceCPU])
+	assert.Equal(t, resource.MustParse("256Mi"), resources.Requests[corev1.ResourceMemory])
+	assert.Equal(t, resource.MustParse("512Mi"), resources.Limits[corev1.ResourceMemory])
+}
+
+func TestUnleashDefinitionMetadata(t *testing.T) {
+	c := &config.Config{Unleash: config.UnleashConfig{Environment: "dev"}}
+	uc := &UnleashConfig{
+		Name:        "my-instance",
+		Labels:      map[string]string{"cost-center": "1234"},
+		Annotations: map[string]string{"example.com/owner": "team-a"},
+	}
+
+	server := UnleashDefinition(c, uc)
+	assert.Equal(t, map[string]string{"cost-center": "1234", EnvironmentLabelKey: "dev"}, server.GetLabels())
+	assert.Equal(t, "team-a", server.GetAnnotations()["example.com/owner"])
+	assert.Contains(t, server.GetAnnotations(), ConfigChecksumAnnotationKey)
+
+	read := UnleashVariables(&server, false)
+	assert.Equal(t, uc.Labels, read.Labels)
+	assert.Equal(t, uc.Annotations, read.Annotations)
+}
+
+func TestUnleashConfigValidateMetadata(t *testing.T) {
+	newConfig := func() *UnleashConfig {
+		return &UnleashConfig{
+			Name:                      "my-instance",
+			FederationNonce:           "abc123",
+			LogLevel:                  "warn",
+			DatabasePoolMax:           3,
+			DatabasePoolIdleTimeoutMs: 1000,
+		}
+	}
+
+	uc := newConfig()
+	uc.Labels = map[string]string{"cost-center": "1234"}
+	uc.Annotations = map[string]string{"example.com/owner": "team a"}
+	assert.NoError(t, uc.Validate())
+
+	uc = newConfig()
+	uc.Labels = map[string]string{"app.kubernetes.io/instance": "other"}
+	assert.EqualError(t, uc.Validate(), `label "app.kubernetes.io/instance" is reserved`)
+
+	uc = newConfig()
+	uc.Annotations = map[string]string{ConfigChecksumAnnotationKey: "abc"}
+	assert.EqualError(t, uc.Validate(), `annotation "bifrost.nais.io/config-checksum" is reserved`)
+
+	uc = newConfig()
+	uc.Labels = map[string]string{"cost-center": "not a valid value"}
+	assert.ErrorContains(t, uc.Validate(), `invalid value for label "cost-center"`)
+}
+
+func TestUnleashConfigJSONFieldNames(t *testing.T) {
+	uc := UnleashConfig{
+		Name:                      "my-instance",
+		CustomVersion:             "v5.10.2-20240329-070801-0180a96",
+		EnableFederation:          true,
+		FederationNonce:           "abc123",
+		AllowedTeams:              "team-a",
+		AllowedNamespaces:         "team-a",
+		AllowedClusters:           "dev-gcp",
+		LogLevel:                  "warn",
+		DatabasePoolMax:           3,
+		DatabasePoolIdleTimeoutMs: 1000,
+		AllowedEgressFQDNs:        "hooks.example.com",
+		Labels:                    map[string]string{"team": "team-a"},
+		Annotations:               map[string]string{"example.com/owner": "team-a"},
+		DatabaseCharset:           "UTF8",
+		DatabaseCollation:         "en_US.UTF8",
+		CPURequest:                "250m",
+		MemoryRequest:             "256Mi",
+		MemoryLimit:               "512Mi",
+	}
+
+	data, err := json.Marshal(uc)
+	assert.NoError(t, err)
+
+	var fields map[string]any
+	assert.NoError(t, json.Unmarshal(data, &fields))
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	assert.ElementsMatch(t, []string{
+		"name",
+		"custom-version",
+		"enable-federation",
+		"allowed-teams",
+		"allowed-namespaces",
+		"allowed-clusters",
+		"log-level",
+		"database-pool-max",
+		"database-pool-idle-timeout-ms",
+		"allowed-egress-fqdns",
+		"labels",
+		"annotations",
+		"database-charset",
+		"database-collation",
+		"cpu-request",
+		"memory-request",
+		"memory-limit",
+	}, keys)
+
+	var roundTrip UnleashConfig
+	assert.NoError(t, json.Unmarshal(data, &roundTrip))
+
+	uc.FederationNonce = ""
+	assert.Equal(t, uc, roundTrip)
+}
+
+func TestUnleashConfigValidateIngressHosts(t *testing.T) {
+	suffix := "unleash-web.example.com"
+
+	tests := []struct {
+		name  string
+		valid bool
+		err   string
+	}{
+		{strings.Repeat("a", 62-len("-unleash-web")), true, ""},
+		{strings.Repeat("a", 63-len("-unleash-web")), true, ""},
+		{strings.Repeat("a", 64-len("-unleash-web")), false, `has a first label of 64 characters, exceeding the limit of 63`},
+	}
+
+	for _, tt := range tests {
+		uc := &UnleashConfig{Name: tt.name}
+		err := uc.ValidateIngressHosts(suffix)
+		if tt.valid {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorContains(t, err, tt.err)
+		}
+	}
+
+	longSuffix := "x." + strings.Repeat("example.", 30) + "com"
+	uc := &UnleashConfig{Name: strings.Repeat("a", 253-len(longSuffix)-1)}
+	assert.NoError(t, uc.ValidateIngressHosts(longSuffix))
+
+	uc.Name += "a"
+	assert.ErrorContains(t, uc.ValidateIngressHosts(longSuffix), "is 254 characters, exceeding the limit of 253")
+}
+
+func TestUnleashConfigValidateReportsAllFailures(t *testing.T) {
+	uc := &UnleashConfig{
+		Name:                      "my-instance",
+		FederationNonce:           "abc123",
+		LogLevel:                  "loud",
+		DatabasePoolMax:           3,
+		DatabasePoolIdleTimeoutMs: 1000,
+		CPURequest:                "lots",
+		Labels:                    map[string]string{"bifrost.nais.io/owner": "me"},
+	}
+
+	err := errors.Join(uc.Validate(), uc.ValidateDatabasePoolIdleTimeout(100, 500))
+	assert.ErrorIs(t, err, ErrInvalidDatabasePoolTimeout)
+
+	details := ValidationDetails(err)
+	assert.Len(t, details, 4)
+	assert.Contains(t, details["log-level"], "'oneof' tag")
+	assert.Contains(t, details["cpu-request"], `invalid cpu-request "lots"`)
+	assert.Equal(t, `label "bifrost.nais.io/owner" is reserved`, details["labels"])
+	assert.Contains(t, details["database-pool-idle-timeout-ms"], "1000 ms is outside the allowed range 100-500 ms")
+
+	assert.Equal(t, map[string]string{"config": "boom"}, ValidationDetails(errors.New("boom")))
+	assert.Empty(t, ValidationDetails(nil))
+}
+
+func TestUnleashConfigValidateFederationNonce(t *testing.T) {
+	tests := []struct {
+		nonce string
+		valid bool
+	}{
+		{"abcd1234", true},
+		{"ABCDefgh12345678", true},
+		{"abc123", false},
+		{"", false},
+		{"abcd-1234", false},
+		{"abcd 1234", false},
+	}
+
+	for _, tt := range tests {
+		uc := &UnleashConfig{FederationNonce: tt.nonce}
+		err := uc.ValidateFederationNonce(8)
+		if tt.valid {
+			assert.NoError(t, err, tt.nonce)
+		} else {
+			assert.ErrorIs(t, err, ErrWeakFederationNonce, tt.nonce)
+		}
+	}
+
+	uc := &UnleashConfig{FederationNonce: "abc123"}
+	assert.NoError(t, uc.ValidateFederationNonce(0))
+}
+
+func TestUnleashDefinitionResources(t *testing.T) {
+	c := &config.Config{}
+
+	defaults := UnleashDefinition(c, &UnleashConfig{Name: "my-instance"})
+	assert.Equal(t, corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("128Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("256Mi"),
+		},
+	}, defaults.Spec.Resources)
+
+	uc := UnleashVariables(&defaults, false)
+	assert.Empty(t, uc.CPURequest)
+	assert.Empty(t, uc.MemoryRequest)
+	assert.Empty(t, uc.MemoryLimit)
+
+	custom := UnleashDefinition(c, &UnleashConfig{Name: "my-instance", CPURequest: "250m", MemoryLimit: "1Gi"})
+	assert.Equal(t, corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("250m"),
+			corev1.ResourceMemory: resource.MustParse("128Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+	}, custom.Spec.Resources)
+
+	uc = UnleashVariables(&custom, true)
+	assert.Equal(t, "250m", uc.CPURequest)
+	assert.Empty(t, uc.MemoryRequest)
+	assert.Equal(t, "1Gi", uc.MemoryLimit)
+}
+
+func TestUnleashConfigValidateResources(t *testing.T) {
+	uc := &UnleashConfig{
+		Name:                      "my-instance",
+		FederationNonce:           "abc123",
+		LogLevel:                  "warn",
+		DatabasePoolMax:           3,
+		DatabasePoolIdleTimeoutMs: 1000,
+		CPURequest:                "250m",
+		MemoryRequest:             "256Mi",
+		MemoryLimit:               "512Mi",
+	}
+	assert.NoError(t, uc.Validate())
+
+	uc.MemoryLimit = "lots"
+	assert.ErrorContains(t, uc.Validate(), `invalid memory-limit "lots"`)
+
+	uc.MemoryRequest = "512Mi"
+	uc.MemoryLimit = ""
+	err := uc.Validate()
+	var fieldErr *FieldError
+	if assert.ErrorAs(t, err, &fieldErr) {
+		assert.Equal(t, "memory-request", fieldErr.Field)
+	}
+	assert.ErrorContains(t, err, "memory-request 512Mi is larger than memory-limit 256Mi")
+
+	uc.MemoryLimit = "512Mi"
+	assert.NoError(t, uc.Validate())
+}
@@ -3,11 +3,18 @@ package unleash
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
 
 	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/metrics"
 	unleashv1 "github.com/nais/unleasherator/api/v1"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
 	admin "google.golang.org/api/sqladmin/v1beta4"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -17,7 +24,14 @@ type IUnleashService interface {
 	Get(ctx context.Context, name string) (*UnleashInstance, error)
 	Create(ctx context.Context, uc *UnleashConfig) (*unleashv1.Unleash, error)
 	Update(ctx context.Context, uc *UnleashConfig) (*unleashv1.Unleash, error)
-	Delete(ctx context.Context, name string) error
+	Delete(ctx context.Context, name string, opts DeleteOptions) error
+	DatabaseSecretExists(ctx context.Context, name string) (bool, error)
+	RepairDatabaseSecret(ctx context.Context, name string) error
+	ListArchived(ctx context.Context) ([]*UnleashInstance, error)
+	Restore(ctx context.Context, name string) (*unleashv1.Unleash, error)
+	Egress(ctx context.Context, name string) (*EgressSummary, error)
+	RotateCredentials(ctx context.Context, name string, restart bool) error
+	ReadyReplicas(ctx context.Context, name string) (int32, error)
 }
 
 type ISQLDatabasesService interface {
@@ -29,28 +43,76 @@ type ISQLDatabasesService interface {
 type ISQLUsersService interface {
 	Get(project string, instance string, name string) *admin.UsersGetCall
 	Insert(project string, instance string, user *admin.User) *admin.UsersInsertCall
+	Update(project string, instance string, user *admin.User) *admin.UsersUpdateCall
 	Delete(project string, instance string) *admin.UsersDeleteCall
 }
 
+var ErrDatabaseSecretExists = errors.New("database secret already exists")
+
+var ErrDatabaseUserNotFound = errors.New("database user not found")
+
+var ErrInvalidDatabasePoolTimeout = errors.New("invalid database pool idle timeout")
+
+var ErrWeakFederationNonce = errors.New("weak federation nonce")
+
+type DeleteOptions struct {
+	// OrphanDatabase keeps the Cloud SQL database and user when deleting the instance.
+	OrphanDatabase bool
+	// Archive keeps the database, database user and secret, and stores the instance config so it can be restored.
+	Archive bool
+}
+
+type inflightCreate struct {
+	done     chan struct{}
+	instance *unleashv1.Unleash
+	err      error
+}
+
 type UnleashService struct {
 	sqlDatabasesClient ISQLDatabasesService
 	sqlUsersClient     ISQLUsersService
 	kubeClient         ctrl.Client
 	config             *config.Config
 	logger             *logrus.Logger
+
+	createsMu sync.Mutex
+	creates   map[string]*inflightCreate
+
+	sqlDeleteSlots chan struct{}
+	sqlRetry       sqlRetry
+
+	events EventPublisher
 }
 
+const sqlRetryDelay = 500 * time.Millisecond
+
 func NewUnleashService(sqlDatabasesClient ISQLDatabasesService, sqlUsersClient ISQLUsersService, kubeClient ctrl.Client, config *config.Config, logger *logrus.Logger) *UnleashService {
+	maxConcurrentDeletes := config.Unleash.SQLMaxConcurrentDeletes
+	if maxConcurrentDeletes < 1 {
+		maxConcurrentDeletes = 1
+	}
+
 	return &UnleashService{
 		sqlDatabasesClient: sqlDatabasesClient,
 		sqlUsersClient:     sqlUsersClient,
 		kubeClient:         kubeClient,
 		config:             config,
 		logger:             logger,
+		creates:            map[string]*inflightCreate{},
+		sqlDeleteSlots:     make(chan struct{}, maxConcurrentDeletes),
+		sqlRetry:           sqlRetry{attempts: config.Unleash.SQLOperationMaxRetries, delay: sqlRetryDelay},
+		events:             NewEventPublisher(config, logger),
 	}
 }
 
-func (s *UnleashService) List(ctx context.Context) ([]*UnleashInstance, error) {
+// Close waits for queued instance events to be published, it must be called after the last request has finished.
+func (s *UnleashService) Close(ctx context.Context) error {
+	return s.events.Close(ctx)
+}
+
+func (s *UnleashService) List(ctx context.Context) (_ []*UnleashInstance, err error) {
+	defer func() { metrics.ObserveUnleashOperation("list", err) }()
+
 	instanceList := []*UnleashInstance{}
 
 	serverList := unleashv1.UnleashList{
@@ -64,7 +126,7 @@ func (s *UnleashService) List(ctx context.Context) ([]*UnleashInstance, error) {
 		Namespace: s.config.Unleash.InstanceNamespace,
 	}
 
-	if err := s.kubeClient.List(ctx, &serverList, &opts); err != nil {
+	if err = s.kubeClient.List(ctx, &serverList, &opts); err != nil {
 		return nil, err
 	}
 
@@ -75,7 +137,9 @@ func (s *UnleashService) List(ctx context.Context) ([]*UnleashInstance, error) {
 	return instanceList, nil
 }
 
-func (s *UnleashService) Get(ctx context.Context, name string) (*UnleashInstance, error) {
+func (s *UnleashService) Get(ctx context.Context, name string) (_ *UnleashInstance, err error) {
+	defer func() { metrics.ObserveUnleashOperation("get", err) }()
+
 	serverInstance := &unleashv1.Unleash{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Unleash",
@@ -87,7 +151,7 @@ func (s *UnleashService) Get(ctx context.Context, name string) (*UnleashInstance
 		},
 	}
 
-	if err := s.kubeClient.Get(ctx, ctrl.ObjectKeyFromObject(serverInstance), serverInstance); err != nil {
+	if err = s.kubeClient.Get(ctx, ctrl.ObjectKeyFromObject(serverInstance), serverInstance); err != nil {
 		return nil, err
 	}
 
@@ -95,34 +159,222 @@ func (s *UnleashService) Get(ctx context.Context, name string) (*UnleashInstance
 }
 
 func (s *UnleashService) Create(ctx context.Context, uc *UnleashConfig) (*unleashv1.Unleash, error) {
-	database, dbErr := createDatabase(ctx, s.sqlDatabasesClient, s.config.Google.ProjectID, s.config.Unleash.SQLInstanceID, uc.Name)
-	databaseUser, dbUserErr := createDatabaseUser(ctx, s.sqlUsersClient, s.config.Google.ProjectID, s.config.Unleash.SQLInstanceID, uc.Name)
-	secretErr := createDatabaseUserSecret(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, s.config.Unleash.SQLInstanceID, s.config.Unleash.SQLInstanceAddress, s.config.Google.ProjectID, database, databaseUser)
-	fqdnError := createFQDNNetworkPolicy(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, database.Name)
+	if !s.config.Unleash.DedupCreates {
+		return s.create(ctx, uc)
+	}
+
+	s.createsMu.Lock()
+	if inflight, ok := s.creates[uc.Name]; ok {
+		s.createsMu.Unlock()
+		s.logger.WithField("instance", uc.Name).Info("Waiting for in-flight create of the same instance")
+
+		select {
+		case <-inflight.done:
+			return inflight.instance, inflight.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	inflight := &inflightCreate{done: make(chan struct{})}
+	s.creates[uc.Name] = inflight
+	s.createsMu.Unlock()
+
+	inflight.instance, inflight.err = s.create(ctx, uc)
+
+	s.createsMu.Lock()
+	delete(s.creates, uc.Name)
+	s.createsMu.Unlock()
+	close(inflight.done)
+
+	return inflight.instance, inflight.err
+}
+
+func (s *UnleashService) create(ctx context.Context, uc *UnleashConfig) (_ *unleashv1.Unleash, err error) {
+	defer func() { metrics.ObserveUnleashOperation("create", err) }()
+
+	archived, err := s.isArchived(ctx, uc.Name)
+	if err != nil {
+		return nil, err
+	}
+	if archived {
+		return nil, fmt.Errorf("%w: %s", ErrInstanceArchived, uc.Name)
+	}
+
+	if uc.SQLInstanceID == "" {
+		uc.SQLInstanceID = PlaceSQLInstance(s.config, uc.Name).ID
+	}
+	sqlInstance, err := sqlInstanceByID(s.config, uc.SQLInstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	database, dbErr := createDatabase(ctx, s.sqlDatabasesClient, s.sqlRetry, s.config.Google.ProjectID, sqlInstance.ID, uc.Name, uc.DatabaseCharset, uc.DatabaseCollation)
+	databaseUser, dbUserErr := createDatabaseUser(ctx, s.sqlUsersClient, s.sqlRetry, s.config.Google.ProjectID, sqlInstance.ID, uc.Name)
+	secretErr := createDatabaseUserSecret(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, sqlInstance.ID, sqlInstance.Address, s.config.Google.ProjectID, database, databaseUser, ResourceLabels(s.config))
+	fqdnError := createFQDNNetworkPolicy(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, database.Name, ResourceLabels(s.config), PolicyEgressFQDNs(s.config, uc))
 	unleashInstance, serverError := createServer(ctx, s.kubeClient, s.config, uc)
 
-	if err := errors.Join(dbErr, dbUserErr, secretErr, fqdnError, serverError); err != nil {
+	if err = errors.Join(dbErr, dbUserErr, secretErr, fqdnError, serverError); err != nil {
 		return nil, err
 	}
+
+	s.events.Publish(newInstanceEvent(EventActionCreate, uc))
 	return unleashInstance, nil
 }
 
-func (s *UnleashService) Update(ctx context.Context, uc *UnleashConfig) (*unleashv1.Unleash, error) {
-	fqdnError := updateFQDNNetworkPolicy(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, uc.Name)
+func (s *UnleashService) Update(ctx context.Context, uc *UnleashConfig) (_ *unleashv1.Unleash, err error) {
+	defer func() { metrics.ObserveUnleashOperation("update", err) }()
+
+	fqdnError := updateFQDNNetworkPolicy(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, uc.Name, ResourceLabels(s.config), PolicyEgressFQDNs(s.config, uc))
 	unleashInstance, serverError := updateServer(ctx, s.kubeClient, s.config, uc)
 
-	if err := errors.Join(fqdnError, serverError); err != nil {
+	if err = errors.Join(fqdnError, serverError); err != nil {
 		return nil, err
 	}
+
+	s.events.Publish(newInstanceEvent(EventActionUpdate, uc))
 	return unleashInstance, nil
 }
 
-func (s *UnleashService) Delete(ctx context.Context, name string) error {
+func (s *UnleashService) Delete(ctx context.Context, name string, opts DeleteOptions) (err error) {
+	defer func() { metrics.ObserveUnleashOperation("delete", err) }()
+	defer func() {
+		if err == nil {
+			s.events.Publish(Event{Action: EventActionDelete, Name: name, Timestamp: time.Now().UTC()})
+		}
+	}()
+
+	if opts.Archive {
+		return s.archiveServer(ctx, name)
+	}
+
+	sqlInstance, err := s.sqlInstanceFor(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if drainSeconds := s.config.Unleash.DeleteDrainSeconds; drainSeconds > 0 {
+		if drainErr := drainServer(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name, time.Duration(drainSeconds)*time.Second); drainErr != nil {
+			s.logger.WithError(drainErr).WithField("instance", name).Warn("Failed to drain instance before delete")
+		}
+	}
+
 	serverErr := deleteServer(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
 	netPolErr := deleteFQDNNetworkPolicy(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
 	dbUserSecretErr := deleteDatabaseUserSecret(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
-	dbErr := deleteDatabase(ctx, s.sqlDatabasesClient, s.config.Google.ProjectID, s.config.Unleash.SQLInstanceID, name)
-	dbUserErr := deleteDatabaseUser(ctx, s.sqlUsersClient, s.config.Google.ProjectID, s.config.Unleash.SQLInstanceID, name)
+
+	if opts.OrphanDatabase {
+		s.logger.WithField("instance", name).Info("Keeping database and database user for deleted instance")
+		return errors.Join(serverErr, netPolErr, dbUserSecretErr)
+	}
+
+	select {
+	case s.sqlDeleteSlots <- struct{}{}:
+	case <-ctx.Done():
+		return errors.Join(serverErr, netPolErr, dbUserSecretErr, ctx.Err())
+	}
+	defer func() { <-s.sqlDeleteSlots }()
+
+	dbErr := deleteDatabase(ctx, s.sqlDatabasesClient, s.config.Google.ProjectID, sqlInstance.ID, name)
+	dbUserErr := deleteDatabaseUser(ctx, s.sqlUsersClient, s.config.Google.ProjectID, sqlInstance.ID, name)
 
 	return errors.Join(serverErr, netPolErr, dbUserSecretErr, dbUserErr, dbErr)
 }
+
+func (s *UnleashService) DatabaseSecretExists(ctx context.Context, name string) (bool, error) {
+	_, err := getDatabaseUserSecret(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
+	if err == nil {
+		return true, nil
+	}
+
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// RepairDatabaseSecret recreates a missing database secret. The old password is lost with the secret, so the
+// database user is given a new password first.
+func (s *UnleashService) RepairDatabaseSecret(ctx context.Context, name string) error {
+	exists, err := s.DatabaseSecretExists(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrDatabaseSecretExists
+	}
+
+	sqlInstance, err := s.sqlInstanceFor(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	user, err := updateDatabaseUserPassword(ctx, s.sqlUsersClient, s.config.Google.ProjectID, sqlInstance.ID, name)
+	if err != nil {
+		return err
+	}
+
+	s.logger.WithField("instance", name).Warn("Recreating missing database secret")
+
+	return createDatabaseUserSecret(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, sqlInstance.ID, sqlInstance.Address, s.config.Google.ProjectID, &admin.Database{Name: name}, user, ResourceLabels(s.config))
+}
+
+// RotateCredentials sets a new password for the database user and writes it to the database secret.
+// A failure after the password was changed leaves the secret stale, so the operation is safe to retry.
+func (s *UnleashService) RotateCredentials(ctx context.Context, name string, restart bool) error {
+	sqlInstance, err := s.sqlInstanceFor(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := getDatabaseUser(ctx, s.sqlUsersClient, s.config.Google.ProjectID, sqlInstance.ID, name); err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return ErrDatabaseUserNotFound
+		}
+		return err
+	}
+
+	secret, err := getDatabaseUserSecret(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
+	if err != nil {
+		return err
+	}
+
+	user, err := updateDatabaseUserPassword(ctx, s.sqlUsersClient, s.config.Google.ProjectID, sqlInstance.ID, name)
+	if err != nil {
+		return err
+	}
+
+	if err := updateDatabaseUserSecret(ctx, s.kubeClient, secret, user); err != nil {
+		return err
+	}
+
+	s.logger.WithField("instance", name).Info("Rotated database credentials")
+
+	if !restart {
+		return nil
+	}
+
+	server, err := getServer(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
+	if err != nil {
+		return err
+	}
+
+	if server.Annotations == nil {
+		server.Annotations = map[string]string{}
+	}
+	server.Annotations[CredentialsRotatedAtAnnotationKey] = time.Now().UTC().Format(time.RFC3339)
+
+	if err := s.kubeClient.Update(ctx, server); err != nil {
+		return &UnleashError{Err: err, Reason: "failed to update Unleash instance"}
+	}
+
+	return nil
+}
+
+func (s *UnleashService) ReadyReplicas(ctx context.Context, name string) (int32, error) {
+	return getReadyReplicas(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
+}
@@ -0,0 +1,755 @@
+package unleash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	fqdnV1alpha3 "github.com/GoogleCloudPlatform/gke-fqdnnetworkpolicies-golang/api/v1alpha3"
+	"github.com/nais/bifrost/pkg/config"
+	"github.com/nais/bifrost/pkg/metrics"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	admin "google.golang.org/api/sqladmin/v1beta4"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	client_go_scheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+type sqlAdminRequest struct {
+	Method string
+	Path   string
+}
+
+type fakeSQLAdmin struct {
+	mu       sync.Mutex
+	requests []sqlAdminRequest
+	handler  func(w http.ResponseWriter, r *http.Request)
+	server   *httptest.Server
+}
+
+func newFakeSQLAdmin(t *testing.T) *fakeSQLAdmin {
+	f := &fakeSQLAdmin{}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests = append(f.requests, sqlAdminRequest{Method: r.Method, Path: r.URL.Path})
+		handler := f.handler
+		f.mu.Unlock()
+
+		if handler != nil {
+			handler(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+func (f *fakeSQLAdmin) service(t *testing.T) *admin.Service {
+	service, err := admin.NewService(context.Background(),
+		option.WithEndpoint(f.server.URL),
+		option.WithHTTPClient(f.server.Client()),
+		option.WithoutAuthentication(),
+	)
+	assert.NoError(t, err)
+
+	return service
+}
+
+func (f *fakeSQLAdmin) count(method, suffix string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, r := range f.requests {
+		if r.Method == method && strings.HasSuffix(r.Path, suffix) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func newFakeKubeClient(t *testing.T, objs ...ctrl.Object) ctrl.Client {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, fqdnV1alpha3.AddToScheme(scheme))
+	assert.NoError(t, unleashv1.AddToScheme(scheme))
+	assert.NoError(t, client_go_scheme.AddToScheme(scheme))
+
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func newTestConfig() *config.Config {
+	return &config.Config{
+		Google: config.GoogleConfig{
+			ProjectID:           "my-project",
+			ProjectNumber:       "1234",
+			IAPBackendServiceID: "5678",
+		},
+		Unleash: config.UnleashConfig{
+			InstanceNamespace:       "unleash-ns",
+			InstanceServiceaccount:  "unleash-sa",
+			SQLInstanceID:           "my-sql-instance",
+			SQLInstanceRegion:       "my-region",
+			SQLInstanceAddress:      "1.2.3.4",
+			InstanceWebIngressHost:  "unleash-web.example.com",
+			InstanceWebIngressClass: "unleash-web-ingress-class",
+			InstanceAPIIngressHost:  "unleash-api.example.com",
+			InstanceAPIIngressClass: "unleash-api-ingress-class",
+			TeamsApiURL:             "https://teams.example.com/query",
+			TeamsApiSecretName:      "teams-api-secret",
+			TeamsApiSecretTokenKey:  "token",
+		},
+		CloudConnectorProxy: "repo/connector:latest",
+	}
+}
+
+func newTestService(t *testing.T, c *config.Config, objs ...ctrl.Object) (*UnleashService, *fakeSQLAdmin, ctrl.Client) {
+	sqlAdmin := newFakeSQLAdmin(t)
+	sqlService := sqlAdmin.service(t)
+	kubeClient := newFakeKubeClient(t, objs...)
+
+	service := NewUnleashService(sqlService.Databases, sqlService.Users, kubeClient, c, logrus.New())
+
+	return service, sqlAdmin, kubeClient
+}
+
+func TestUnleashServiceCreateEnvironmentLabel(t *testing.T) {
+	ctx := context.Background()
+	c := newTestConfig()
+	c.Unleash.Environment = "dev"
+
+	service, sqlAdmin, kubeClient := newTestService(t, c)
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sqlAdmin.count("POST", "/databases"))
+	assert.Equal(t, 1, sqlAdmin.count("POST", "/users"))
+
+	key := ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance"}
+
+	server := &unleashv1.Unleash{}
+	assert.NoError(t, kubeClient.Get(ctx, key, server))
+	assert.Equal(t, "dev", server.GetLabels()[EnvironmentLabelKey])
+
+	secret := &corev1.Secret{}
+	assert.NoError(t, kubeClient.Get(ctx, key, secret))
+	assert.Equal(t, "dev", secret.GetLabels()[EnvironmentLabelKey])
+
+	fqdn := &fqdnV1alpha3.FQDNNetworkPolicy{}
+	assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance-fqdn"}, fqdn))
+	assert.Equal(t, "dev", fqdn.GetLabels()[EnvironmentLabelKey])
+}
+
+func TestUnleashServiceCreateWithoutEnvironment(t *testing.T) {
+	ctx := context.Background()
+	service, _, kubeClient := newTestService(t, newTestConfig())
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+	assert.NoError(t, err)
+
+	server := &unleashv1.Unleash{}
+	assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance"}, server))
+	assert.NotContains(t, server.GetLabels(), EnvironmentLabelKey)
+}
+
+func TestUnleashServiceCreateDedup(t *testing.T) {
+	ctx := context.Background()
+	c := newTestConfig()
+	c.Unleash.DedupCreates = true
+
+	service, sqlAdmin, _ := newTestService(t, c)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	sqlAdmin.handler = func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/databases") {
+			once.Do(func() { close(started) })
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*unleashv1.Unleash, 2)
+	errs := make([]error, 2)
+
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+		}(i)
+
+		if i == 0 {
+			<-started
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.Same(t, results[0], results[1])
+	assert.Equal(t, 1, sqlAdmin.count("POST", "/databases"))
+	assert.Equal(t, 1, sqlAdmin.count("POST", "/users"))
+}
+
+func TestUnleashServiceDeleteConcurrency(t *testing.T) {
+	ctx := context.Background()
+	c := newTestConfig()
+	c.Unleash.SQLMaxConcurrentDeletes = 2
+
+	service, sqlAdmin, _ := newTestService(t, c)
+
+	names := []string{"team-a", "team-b", "team-c", "team-d", "team-e", "team-f"}
+	for _, name := range names {
+		_, err := service.Create(ctx, &UnleashConfig{Name: name, FederationNonce: "abc123"})
+		assert.NoError(t, err)
+	}
+
+	var mu sync.Mutex
+	inflight, maxInflight := 0, 0
+	sqlAdmin.handler = func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			mu.Lock()
+			inflight++
+			if inflight > maxInflight {
+				maxInflight = inflight
+			}
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			inflight--
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			assert.NoError(t, service.Delete(ctx, name, DeleteOptions{}))
+		}(name)
+	}
+	wg.Wait()
+
+	assert.Equal(t, len(names), sqlAdmin.count("DELETE", "/users"))
+	assert.LessOrEqual(t, maxInflight, 2)
+	assert.Greater(t, maxInflight, 0)
+}
+
+func TestUnleashServiceOperationMetrics(t *testing.T) {
+	ctx := context.Background()
+	service, _, _ := newTestService(t, newTestConfig())
+
+	getErrors := testutil.ToFloat64(metrics.UnleashOperations.WithLabelValues("get", "error"))
+	createSuccess := testutil.ToFloat64(metrics.UnleashOperations.WithLabelValues("create", "success"))
+
+	_, err := service.Get(ctx, "does-not-exist")
+	assert.Error(t, err)
+
+	_, err = service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, getErrors+1, testutil.ToFloat64(metrics.UnleashOperations.WithLabelValues("get", "error")))
+	assert.Equal(t, createSuccess+1, testutil.ToFloat64(metrics.UnleashOperations.WithLabelValues("create", "success")))
+}
+
+func TestUnleashServiceAllowedEgressFQDNs(t *testing.T) {
+	ctx := context.Background()
+	service, _, kubeClient := newTestService(t, newTestConfig())
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123", AllowedEgressFQDNs: "hooks.example.com"})
+	assert.NoError(t, err)
+
+	fqdnKey := ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance-fqdn"}
+	fqdn := &fqdnV1alpha3.FQDNNetworkPolicy{}
+	assert.NoError(t, kubeClient.Get(ctx, fqdnKey, fqdn))
+	assert.Contains(t, fqdn.Spec.Egress[0].To[0].FQDNs, "hooks.example.com")
+
+	_, err = service.Update(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, kubeClient.Get(ctx, fqdnKey, fqdn))
+	assert.Equal(t, DefaultEgressFQDNs, fqdn.Spec.Egress[0].To[0].FQDNs)
+}
+
+func TestUnleashServiceRepairDatabaseSecret(t *testing.T) {
+	ctx := context.Background()
+	service, sqlAdmin, kubeClient := newTestService(t, newTestConfig())
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+	assert.NoError(t, err)
+
+	exists, err := service.DatabaseSecretExists(ctx, "my-instance")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.ErrorIs(t, service.RepairDatabaseSecret(ctx, "my-instance"), ErrDatabaseSecretExists)
+
+	key := ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance"}
+	oldSecret := &corev1.Secret{}
+	assert.NoError(t, kubeClient.Get(ctx, key, oldSecret))
+	assert.NoError(t, kubeClient.Delete(ctx, oldSecret))
+
+	exists, err = service.DatabaseSecretExists(ctx, "my-instance")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.NoError(t, service.RepairDatabaseSecret(ctx, "my-instance"))
+	assert.Equal(t, 1, sqlAdmin.count("PUT", "/users"))
+
+	secret := &corev1.Secret{}
+	assert.NoError(t, kubeClient.Get(ctx, key, secret))
+	assert.Equal(t, "my-instance", string(secret.Data["POSTGRES_USER"]))
+	assert.NotEmpty(t, secret.Data["POSTGRES_PASSWORD"])
+	assert.NotEqual(t, oldSecret.Data["POSTGRES_PASSWORD"], secret.Data["POSTGRES_PASSWORD"])
+}
+
+func TestUnleashServiceUpdateMetadata(t *testing.T) {
+	ctx := context.Background()
+	c := newTestConfig()
+	c.Unleash.Environment = "dev"
+	service, _, kubeClient := newTestService(t, c)
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123", Labels: map[string]string{"cost-center": "1234"}})
+	assert.NoError(t, err)
+
+	key := ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance"}
+	server := &unleashv1.Unleash{}
+	assert.NoError(t, kubeClient.Get(ctx, key, server))
+	server.Labels["app.kubernetes.io/managed-by"] = "unleasherator"
+	assert.NoError(t, kubeClient.Update(ctx, server))
+
+	_, err = service.Update(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123", Labels: map[string]string{"team": "team-a"}})
+	assert.NoError(t, err)
+
+	assert.NoError(t, kubeClient.Get(ctx, key, server))
+	assert.Equal(t, map[string]string{
+		"team":                         "team-a",
+		"app.kubernetes.io/managed-by": "unleasherator",
+		EnvironmentLabelKey:            "dev",
+	}, server.GetLabels())
+}
+
+func TestUnleashServiceDeleteDrain(t *testing.T) {
+	ctx := context.Background()
+	c := newTestConfig()
+	c.Unleash.DeleteDrainSeconds = 1
+
+	var mu sync.Mutex
+	calls := []string{}
+	record := func(call string, obj ctrl.Object) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, fmt.Sprintf("%s %s", call, reflect.TypeOf(obj).Elem().Name()))
+	}
+
+	replicas := int32(2)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-instance", Namespace: "unleash-ns"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+	kubeClient := interceptor.NewClient(newFakeKubeClient(t, deployment).(ctrl.WithWatch), interceptor.Funcs{
+		Update: func(ctx context.Context, client ctrl.WithWatch, obj ctrl.Object, opts ...ctrl.UpdateOption) error {
+			record("update", obj)
+			return client.Update(ctx, obj, opts...)
+		},
+		Delete: func(ctx context.Context, client ctrl.WithWatch, obj ctrl.Object, opts ...ctrl.DeleteOption) error {
+			record("delete", obj)
+			return client.Delete(ctx, obj, opts...)
+		},
+	})
+
+	sqlAdmin := newFakeSQLAdmin(t)
+	sqlService := sqlAdmin.service(t)
+	service := NewUnleashService(sqlService.Databases, sqlService.Users, kubeClient, c, logrus.New())
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+	assert.NoError(t, err)
+
+	start := time.Now()
+	assert.NoError(t, service.Delete(ctx, "my-instance", DeleteOptions{}))
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	assert.Equal(t, []string{
+		"update Deployment",
+		"delete Unleash",
+		"delete FQDNNetworkPolicy",
+		"delete Secret",
+	}, calls)
+
+	assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKeyFromObject(deployment), deployment))
+	assert.Equal(t, int32(0), *deployment.Spec.Replicas)
+}
+
+func TestUnleashServiceCreateSQLRetry(t *testing.T) {
+	ctx := context.Background()
+	c := newTestConfig()
+	c.Unleash.SQLOperationMaxRetries = 3
+
+	service, sqlAdmin, _ := newTestService(t, c)
+	service.sqlRetry.delay = time.Millisecond
+
+	var mu sync.Mutex
+	failures := map[string]int{}
+	sqlAdmin.handler = func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		failures[r.URL.Path]++
+		fail := r.Method == "POST" && failures[r.URL.Path] <= 2
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":{"code":503,"message":"backend unavailable"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, sqlAdmin.count("POST", "/databases"))
+	assert.Equal(t, 3, sqlAdmin.count("POST", "/users"))
+}
+
+func TestSQLRetry(t *testing.T) {
+	ctx := context.Background()
+	retry := sqlRetry{attempts: 3, delay: time.Millisecond}
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		attempts := 0
+		err := retry.do(ctx, func() error {
+			attempts++
+			return &googleapi.Error{Code: http.StatusTooManyRequests}
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		attempts := 0
+		err := retry.do(ctx, func() error {
+			attempts++
+			return &googleapi.Error{Code: http.StatusConflict}
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("aborts on context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		attempts := 0
+		err := sqlRetry{attempts: 3, delay: time.Hour}.do(ctx, func() error {
+			attempts++
+			return &googleapi.Error{Code: http.StatusServiceUnavailable}
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestUnleashServiceDeleteOrphanDatabase(t *testing.T) {
+	ctx := context.Background()
+	service, sqlAdmin, kubeClient := newTestService(t, newTestConfig())
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, service.Delete(ctx, "my-instance", DeleteOptions{OrphanDatabase: true}))
+	assert.Equal(t, 0, sqlAdmin.count("DELETE", "/databases/my-instance"))
+	assert.Equal(t, 0, sqlAdmin.count("DELETE", "/users"))
+
+	err = kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance"}, &unleashv1.Unleash{})
+	assert.Error(t, err)
+}
+
+func TestUnleashServiceDeleteAggregatesErrors(t *testing.T) {
+	ctx := context.Background()
+	service, sqlAdmin, kubeClient := newTestService(t, newTestConfig())
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+	assert.NoError(t, err)
+
+	secret := &corev1.Secret{}
+	assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance"}, secret))
+	assert.NoError(t, kubeClient.Delete(ctx, secret))
+
+	sqlAdmin.handler = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "DELETE" && strings.HasSuffix(r.URL.Path, "/users") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"code":400,"message":"user in use"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}
+
+	err = service.Delete(ctx, "my-instance", DeleteOptions{})
+	assert.EqualError(t, err, "failed to delete database user secret\nfailed to delete database user")
+
+	// Remaining resources are still deleted
+	assert.Equal(t, 1, sqlAdmin.count("DELETE", "/databases/my-instance"))
+	err = kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance"}, &unleashv1.Unleash{})
+	assert.Error(t, err)
+	err = kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance-fqdn"}, &fqdnV1alpha3.FQDNNetworkPolicy{})
+	assert.Error(t, err)
+}
+
+func TestUnleashServiceArchiveAndRestore(t *testing.T) {
+	ctx := context.Background()
+	service, sqlAdmin, kubeClient := newTestService(t, newTestConfig())
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123", LogLevel: "debug", AllowedEgressFQDNs: "hooks.example.com"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, service.Delete(ctx, "my-instance", DeleteOptions{Archive: true}))
+	assert.Equal(t, 0, sqlAdmin.count("DELETE", "/databases/my-instance"))
+	assert.Equal(t, 0, sqlAdmin.count("DELETE", "/users"))
+
+	key := ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance"}
+	assert.Error(t, kubeClient.Get(ctx, key, &unleashv1.Unleash{}))
+	assert.NoError(t, kubeClient.Get(ctx, key, &corev1.Secret{}))
+
+	instances, err := service.List(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, instances)
+
+	archived, err := service.ListArchived(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, archived, 1)
+	assert.Equal(t, "my-instance", archived[0].Name)
+	assert.Equal(t, "Archived", archived[0].Status())
+
+	_, err = service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+	assert.ErrorIs(t, err, ErrInstanceArchived)
+	assert.Equal(t, 1, sqlAdmin.count("POST", "/databases"))
+
+	// A policy left behind by an earlier failed restore is taken over
+	assert.NoError(t, createFQDNNetworkPolicy(ctx, kubeClient, "unleash-ns", "my-instance", nil, nil))
+
+	server, err := service.Restore(ctx, "my-instance")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", server.Spec.Federation.SecretNonce)
+
+	restored := &unleashv1.Unleash{}
+	assert.NoError(t, kubeClient.Get(ctx, key, restored))
+	uc := UnleashVariables(restored, false)
+	assert.Equal(t, "debug", uc.LogLevel)
+	assert.Equal(t, "hooks.example.com", uc.AllowedEgressFQDNs)
+
+	fqdn := &fqdnV1alpha3.FQDNNetworkPolicy{}
+	assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance-fqdn"}, fqdn))
+	assert.Contains(t, fqdn.Spec.Egress[0].To[0].FQDNs, "hooks.example.com")
+
+	archived, err = service.ListArchived(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, archived)
+
+	_, err = service.Restore(ctx, "my-instance")
+	assert.ErrorIs(t, err, ErrInstanceNotArchived)
+}
+
+func TestUnleashServiceEgress(t *testing.T) {
+	ctx := context.Background()
+	c := newTestConfig()
+	c.Unleash.ExtraEgressFQDNs = "logs.example.com"
+	service, _, _ := newTestService(t, c)
+
+	_, err := service.Egress(ctx, "my-instance")
+	assert.Error(t, err)
+
+	_, err = service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123", AllowedEgressFQDNs: "hooks.example.com"})
+	assert.NoError(t, err)
+
+	summary, err := service.Egress(ctx, "my-instance")
+	assert.NoError(t, err)
+	assert.True(t, summary.AllowDNS)
+
+	sources := map[string]string{"logs.example.com": EgressSourceGlobal, "hooks.example.com": EgressSourceInstance}
+	for _, fqdn := range DefaultEgressFQDNs {
+		sources[fqdn] = EgressSourceDefault
+	}
+
+	assert.Equal(t, []EgressRule{
+		{Type: EgressRuleTypeCIDR, Destinations: []string{"1.2.3.4/32"}, Ports: []string{"TCP/3307"}},
+		{Type: EgressRuleTypeFQDN, Destinations: append(append([]string{}, DefaultEgressFQDNs...), "logs.example.com", "hooks.example.com"), Ports: []string{"TCP/443"}, Sources: sources},
+		{Type: EgressRuleTypeFQDN, Destinations: []string{"metadata.google.internal"}, Ports: []string{"TCP/80", "TCP/988"}, Sources: map[string]string{"metadata.google.internal": EgressSourceDefault}},
+	}, summary.Rules)
+}
+
+func TestUnleashServiceRotateCredentials(t *testing.T) {
+	ctx := context.Background()
+	service, sqlAdmin, kubeClient := newTestService(t, newTestConfig())
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+	assert.NoError(t, err)
+
+	key := ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance"}
+	oldSecret := &corev1.Secret{}
+	assert.NoError(t, kubeClient.Get(ctx, key, oldSecret))
+
+	assert.NoError(t, service.RotateCredentials(ctx, "my-instance", false))
+	assert.Equal(t, 1, sqlAdmin.count("PUT", "/users"))
+
+	secret := &corev1.Secret{}
+	assert.NoError(t, kubeClient.Get(ctx, key, secret))
+	assert.NotEqual(t, oldSecret.Data["POSTGRES_PASSWORD"], secret.Data["POSTGRES_PASSWORD"])
+	assert.Equal(t, oldSecret.Data["POSTGRES_USER"], secret.Data["POSTGRES_USER"])
+
+	server := &unleashv1.Unleash{}
+	assert.NoError(t, kubeClient.Get(ctx, key, server))
+	assert.NotContains(t, server.Annotations, CredentialsRotatedAtAnnotationKey)
+
+	assert.NoError(t, service.RotateCredentials(ctx, "my-instance", true))
+	assert.NoError(t, kubeClient.Get(ctx, key, server))
+	assert.Contains(t, server.Annotations, CredentialsRotatedAtAnnotationKey)
+
+	sqlAdmin.handler = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"code":404,"message":"user not found"}}`))
+	}
+	assert.ErrorIs(t, service.RotateCredentials(ctx, "my-instance", false), ErrDatabaseUserNotFound)
+	assert.Equal(t, 2, sqlAdmin.count("PUT", "/users"))
+}
+
+func TestUnleashServiceDatabaseOperationErrorMetrics(t *testing.T) {
+	ctx := context.Background()
+	c := newTestConfig()
+	c.Unleash.SQLOperationMaxRetries = 1
+
+	service, sqlAdmin, _ := newTestService(t, c)
+	sqlAdmin.handler = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"error":{"code":503,"message":"backend unavailable"}}`))
+	}
+
+	createErrors := testutil.ToFloat64(metrics.DatabaseOperationErrors.WithLabelValues("create_database", "server_error"))
+	getSecretErrors := testutil.ToFloat64(metrics.DatabaseOperationErrors.WithLabelValues("get_secret", "not_found"))
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+	assert.Error(t, err)
+	assert.Equal(t, createErrors+1, testutil.ToFloat64(metrics.DatabaseOperationErrors.WithLabelValues("create_database", "server_error")))
+
+	_, err = getDatabaseUserSecret(ctx, service.kubeClient, "unleash-ns", "does-not-exist")
+	assert.Error(t, err)
+	assert.Equal(t, getSecretErrors+1, testutil.ToFloat64(metrics.DatabaseOperationErrors.WithLabelValues("get_secret", "not_found")))
+}
+
+func TestDatabaseErrorClass(t *testing.T) {
+	tests := []struct {
+		err   error
+		class string
+	}{
+		{&googleapi.Error{Code: http.StatusNotFound}, "not_found"},
+		{&googleapi.Error{Code: http.StatusConflict}, "conflict"},
+		{&googleapi.Error{Code: http.StatusTooManyRequests}, "rate_limited"},
+		{&googleapi.Error{Code: http.StatusForbidden}, "permission_denied"},
+		{&googleapi.Error{Code: http.StatusBadGateway}, "server_error"},
+		{&googleapi.Error{Code: http.StatusBadRequest}, "client_error"},
+		{context.DeadlineExceeded, "timeout"},
+		{fmt.Errorf("boom"), "other"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.class, databaseErrorClass(tt.err), "%v", tt.err)
+	}
+}
+
+func TestUnleashServiceCreateDatabaseFlags(t *testing.T) {
+	ctx := context.Background()
+	service, sqlAdmin, _ := newTestService(t, newTestConfig())
+
+	var mu sync.Mutex
+	var database admin.Database
+	sqlAdmin.handler = func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/databases") {
+			mu.Lock()
+			_ = json.NewDecoder(r.Body).Decode(&database)
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123", DatabaseCharset: "UTF8", DatabaseCollation: "nb_NO.UTF8"})
+	assert.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "my-instance", database.Name)
+	assert.Equal(t, "UTF8", database.Charset)
+	assert.Equal(t, "nb_NO.UTF8", database.Collation)
+}
+
+func TestUnleashServiceUpdatePreservesResources(t *testing.T) {
+	ctx := context.Background()
+	service, _, kubeClient := newTestService(t, newTestConfig())
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123", MemoryLimit: "1Gi"})
+	assert.NoError(t, err)
+
+	instance, err := service.Get(ctx, "my-instance")
+	assert.NoError(t, err)
+
+	uc := UnleashVariables(instance.ServerInstance, true)
+	uc.LogLevel = "debug"
+	_, err = service.Update(ctx, uc)
+	assert.NoError(t, err)
+
+	server := &unleashv1.Unleash{}
+	assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance"}, server))
+	assert.Equal(t, "1Gi", server.Spec.Resources.Limits.Memory().String())
+	assert.Equal(t, "100m", server.Spec.Resources.Requests.Cpu().String())
+}
+
+func TestUnleashServiceReadyReplicas(t *testing.T) {
+	ctx := context.Background()
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-instance", Namespace: "unleash-ns"},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: 2},
+	}
+	service, _, _ := newTestService(t, newTestConfig(), deployment)
+
+	replicas, err := service.ReadyReplicas(ctx, "my-instance")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), replicas)
+
+	replicas, err = service.ReadyReplicas(ctx, "other-instance")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), replicas)
+}
@@ -0,0 +1,74 @@
+package unleash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/nais/bifrost/pkg/config"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+var ErrUnknownSQLInstance = errors.New("unknown sql instance")
+
+func defaultSQLInstance(c *config.Config) config.SQLInstance {
+	return config.SQLInstance{
+		ID:      c.Unleash.SQLInstanceID,
+		Region:  c.Unleash.SQLInstanceRegion,
+		Address: c.Unleash.SQLInstanceAddress,
+	}
+}
+
+// PlaceSQLInstance picks the SQL instance for a new Unleash instance from a hash of its name, so a name is always
+// placed on the same SQL instance as long as the configured list is unchanged.
+func PlaceSQLInstance(c *config.Config, name string) config.SQLInstance {
+	instances, err := c.Unleash.ParseSQLInstances()
+	if err != nil || len(instances) == 0 {
+		return defaultSQLInstance(c)
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+
+	return instances[h.Sum32()%uint32(len(instances))]
+}
+
+// sqlInstanceByID looks up a configured SQL instance, an empty ID is the default SQL instance.
+func sqlInstanceByID(c *config.Config, id string) (config.SQLInstance, error) {
+	if id == "" || id == c.Unleash.SQLInstanceID {
+		return defaultSQLInstance(c), nil
+	}
+
+	instances, err := c.Unleash.ParseSQLInstances()
+	if err != nil {
+		return config.SQLInstance{ID: id}, err
+	}
+
+	for _, instance := range instances {
+		if instance.ID == id {
+			return instance, nil
+		}
+	}
+
+	return config.SQLInstance{ID: id}, fmt.Errorf("%w: %s", ErrUnknownSQLInstance, id)
+}
+
+// SQLInstanceForServer returns the SQL instance recorded on the server. Servers created before placement was
+// recorded are on the default SQL instance.
+func SQLInstanceForServer(c *config.Config, server *unleashv1.Unleash) (config.SQLInstance, error) {
+	return sqlInstanceByID(c, server.GetAnnotations()[SQLInstanceAnnotationKey])
+}
+
+func (s *UnleashService) sqlInstanceFor(ctx context.Context, name string) (config.SQLInstance, error) {
+	server, err := getServer(ctx, s.kubeClient, s.config.Unleash.InstanceNamespace, name)
+	if apierrors.IsNotFound(err) {
+		return defaultSQLInstance(s.config), nil
+	}
+	if err != nil {
+		return config.SQLInstance{}, err
+	}
+
+	return SQLInstanceForServer(s.config, server)
+}
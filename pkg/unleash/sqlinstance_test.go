@@ -0,0 +1,102 @@
+package unleash
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/nais/bifrost/pkg/config"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newMultiSQLInstanceConfig() *config.Config {
+	c := newTestConfig()
+	c.Unleash.SQLInstances = "sql-a:region-a:10.0.0.1,sql-b:region-b:10.0.0.2"
+	return c
+}
+
+func TestPlaceSQLInstance(t *testing.T) {
+	c := newTestConfig()
+	assert.Equal(t, config.SQLInstance{ID: "my-sql-instance", Region: "my-region", Address: "1.2.3.4"}, PlaceSQLInstance(c, "my-instance"))
+
+	c = newMultiSQLInstanceConfig()
+	placed := map[string]int{}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("instance-%d", i)
+		first := PlaceSQLInstance(c, name)
+		assert.Equal(t, first, PlaceSQLInstance(c, name))
+		placed[first.ID]++
+	}
+
+	assert.Len(t, placed, 2)
+	assert.Equal(t, 20, placed["sql-a"]+placed["sql-b"])
+}
+
+func TestSQLInstanceForServer(t *testing.T) {
+	c := newMultiSQLInstanceConfig()
+
+	server := &unleashv1.Unleash{}
+	instance, err := SQLInstanceForServer(c, server)
+	assert.NoError(t, err)
+	assert.Equal(t, "my-sql-instance", instance.ID)
+
+	server.SetAnnotations(map[string]string{SQLInstanceAnnotationKey: "sql-b"})
+	instance, err = SQLInstanceForServer(c, server)
+	assert.NoError(t, err)
+	assert.Equal(t, config.SQLInstance{ID: "sql-b", Region: "region-b", Address: "10.0.0.2"}, instance)
+
+	server.SetAnnotations(map[string]string{SQLInstanceAnnotationKey: "sql-c"})
+	_, err = SQLInstanceForServer(c, server)
+	assert.ErrorIs(t, err, ErrUnknownSQLInstance)
+}
+
+func TestUnleashServiceSQLInstancePlacement(t *testing.T) {
+	ctx := context.Background()
+	c := newMultiSQLInstanceConfig()
+	service, sqlAdmin, kubeClient := newTestService(t, c)
+	placed := PlaceSQLInstance(c, "my-instance")
+
+	_, err := service.Create(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, sqlAdmin.count(http.MethodPost, fmt.Sprintf("/instances/%s/databases", placed.ID)))
+	assert.Equal(t, 1, sqlAdmin.count(http.MethodPost, fmt.Sprintf("/instances/%s/users", placed.ID)))
+
+	server := &unleashv1.Unleash{}
+	assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance"}, server))
+	assert.Equal(t, placed.ID, server.GetAnnotations()[SQLInstanceAnnotationKey])
+	assert.Equal(t, fmt.Sprintf("my-project:%s:%s", placed.Region, placed.ID), server.Spec.ExtraContainers[0].Args[2])
+	assert.Equal(t, placed.Address+"/32", server.Spec.NetworkPolicy.ExtraEgressRules[0].To[0].IPBlock.CIDR)
+
+	_, err = service.Update(ctx, &UnleashConfig{Name: "my-instance", FederationNonce: "abc123", LogLevel: "debug"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: "unleash-ns", Name: "my-instance"}, server))
+	assert.Equal(t, placed.ID, server.GetAnnotations()[SQLInstanceAnnotationKey])
+	assert.Equal(t, fmt.Sprintf("my-project:%s:%s", placed.Region, placed.ID), server.Spec.ExtraContainers[0].Args[2])
+
+	assert.NoError(t, service.Delete(ctx, "my-instance", DeleteOptions{}))
+	assert.Equal(t, 1, sqlAdmin.count(http.MethodDelete, fmt.Sprintf("/instances/%s/databases/my-instance", placed.ID)))
+}
+
+func TestUnleashServiceCreateUnknownSQLInstance(t *testing.T) {
+	service, sqlAdmin, _ := newTestService(t, newMultiSQLInstanceConfig())
+
+	_, err := service.Create(context.Background(), &UnleashConfig{Name: "my-instance", FederationNonce: "abc123", SQLInstanceID: "sql-c"})
+	assert.ErrorIs(t, err, ErrUnknownSQLInstance)
+	assert.Equal(t, 0, sqlAdmin.count(http.MethodPost, "/databases"))
+}
+
+func TestUnleashServiceDeleteLegacySQLInstance(t *testing.T) {
+	ctx := context.Background()
+	server := &unleashv1.Unleash{ObjectMeta: metav1.ObjectMeta{Name: "my-instance", Namespace: "unleash-ns"}}
+	service, sqlAdmin, _ := newTestService(t, newMultiSQLInstanceConfig(), server)
+
+	// Only the Unleash resource exists, the other deletes fail and are aggregated
+	_ = service.Delete(ctx, "my-instance", DeleteOptions{})
+	assert.Equal(t, 1, sqlAdmin.count(http.MethodDelete, "/instances/my-sql-instance/databases/my-instance"))
+}
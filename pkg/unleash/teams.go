@@ -0,0 +1,23 @@
+package unleash
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CheckTeamsApiSecret verifies that the secret holding the teams API token referenced by all instances exists.
+func CheckTeamsApiSecret(ctx context.Context, kubeClient ctrl.Client, namespace, name, key string) error {
+	secret := &corev1.Secret{}
+	if err := kubeClient.Get(ctx, ctrl.ObjectKey{Namespace: namespace, Name: name}, secret); err != nil {
+		return fmt.Errorf("failed to get teams API secret %s/%s: %w", namespace, name, err)
+	}
+
+	if len(secret.Data[key]) == 0 {
+		return fmt.Errorf("teams API secret %s/%s has no value for key %q", namespace, name, key)
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package unleash
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckTeamsApiSecret(t *testing.T) {
+	ctx := context.Background()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "teams-api-secret", Namespace: "unleash-ns"},
+		Data:       map[string][]byte{"token": []byte("secret-token")},
+	}
+
+	t.Run("secret and key present", func(t *testing.T) {
+		kubeClient := newFakeKubeClient(t, secret.DeepCopy())
+
+		assert.NoError(t, CheckTeamsApiSecret(ctx, kubeClient, "unleash-ns", "teams-api-secret", "token"))
+	})
+
+	t.Run("secret missing", func(t *testing.T) {
+		kubeClient := newFakeKubeClient(t)
+
+		err := CheckTeamsApiSecret(ctx, kubeClient, "unleash-ns", "teams-api-secret", "token")
+		assert.ErrorContains(t, err, "failed to get teams API secret unleash-ns/teams-api-secret")
+	})
+
+	t.Run("key missing", func(t *testing.T) {
+		kubeClient := newFakeKubeClient(t, secret.DeepCopy())
+
+		err := CheckTeamsApiSecret(ctx, kubeClient, "unleash-ns", "teams-api-secret", "other")
+		assert.EqualError(t, err, `teams API secret unleash-ns/teams-api-secret has no value for key "other"`)
+	})
+}
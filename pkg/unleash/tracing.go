@@ -0,0 +1,102 @@
+package unleash
+
+import (
+	"context"
+
+	"github.com/nais/bifrost/pkg/tracing"
+	unleashv1 "github.com/nais/unleasherator/api/v1"
+)
+
+// TracedUnleashService wraps an IUnleashService so each operation is a span, with the instance name as an
+// attribute. The Kubernetes and Cloud SQL calls made by the operation are child spans.
+type TracedUnleashService struct {
+	service IUnleashService
+}
+
+func NewTracedUnleashService(service IUnleashService) *TracedUnleashService {
+	return &TracedUnleashService{service: service}
+}
+
+func (t *TracedUnleashService) List(ctx context.Context) (_ []*UnleashInstance, err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.List", "")
+	defer func() { tracing.End(span, err) }()
+
+	return t.service.List(ctx)
+}
+
+func (t *TracedUnleashService) Get(ctx context.Context, name string) (_ *UnleashInstance, err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.Get", name)
+	defer func() { tracing.End(span, err) }()
+
+	return t.service.Get(ctx, name)
+}
+
+func (t *TracedUnleashService) Create(ctx context.Context, uc *UnleashConfig) (_ *unleashv1.Unleash, err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.Create", uc.Name)
+	defer func() { tracing.End(span, err) }()
+
+	return t.service.Create(ctx, uc)
+}
+
+func (t *TracedUnleashService) Update(ctx context.Context, uc *UnleashConfig) (_ *unleashv1.Unleash, err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.Update", uc.Name)
+	defer func() { tracing.End(span, err) }()
+
+	return t.service.Update(ctx, uc)
+}
+
+func (t *TracedUnleashService) Delete(ctx context.Context, name string, opts DeleteOptions) (err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.Delete", name)
+	defer func() { tracing.End(span, err) }()
+
+	return t.service.Delete(ctx, name, opts)
+}
+
+func (t *TracedUnleashService) DatabaseSecretExists(ctx context.Context, name string) (_ bool, err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.DatabaseSecretExists", name)
+	defer func() { tracing.End(span, err) }()
+
+	return t.service.DatabaseSecretExists(ctx, name)
+}
+
+func (t *TracedUnleashService) RepairDatabaseSecret(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.RepairDatabaseSecret", name)
+	defer func() { tracing.End(span, err) }()
+
+	return t.service.RepairDatabaseSecret(ctx, name)
+}
+
+func (t *TracedUnleashService) ListArchived(ctx context.Context) (_ []*UnleashInstance, err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.ListArchived", "")
+	defer func() { tracing.End(span, err) }()
+
+	return t.service.ListArchived(ctx)
+}
+
+func (t *TracedUnleashService) Restore(ctx context.Context, name string) (_ *unleashv1.Unleash, err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.Restore", name)
+	defer func() { tracing.End(span, err) }()
+
+	return t.service.Restore(ctx, name)
+}
+
+func (t *TracedUnleashService) Egress(ctx context.Context, name string) (_ *EgressSummary, err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.Egress", name)
+	defer func() { tracing.End(span, err) }()
+
+	return t.service.Egress(ctx, name)
+}
+
+func (t *TracedUnleashService) RotateCredentials(ctx context.Context, name string, restart bool) (err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.RotateCredentials", name)
+	defer func() { tracing.End(span, err) }()
+
+	return t.service.RotateCredentials(ctx, name, restart)
+}
+
+func (t *TracedUnleashService) ReadyReplicas(ctx context.Context, name string) (_ int32, err error) {
+	ctx, span := tracing.Start(ctx, "UnleashService.ReadyReplicas", name)
+	defer func() { tracing.End(span, err) }()
+
+	return t.service.ReadyReplicas(ctx, name)
+}
@@ -0,0 +1,46 @@
+package unleash
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nais/bifrost/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracedUnleashServiceCreate(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+
+	sqlService := newFakeSQLAdmin(t).service(t)
+	kubeClient := tracing.NewKubeClient(newFakeKubeClient(t))
+	service := NewTracedUnleashService(NewUnleashService(sqlService.Databases, sqlService.Users, kubeClient, newTestConfig(), logrus.New()))
+
+	_, err := service.Create(context.Background(), &UnleashConfig{Name: "my-instance", FederationNonce: "abc123"})
+	assert.NoError(t, err)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	root, ok := spans["UnleashService.Create"]
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Contains(t, root.Attributes(), tracing.InstanceKey.String("my-instance"))
+
+	for _, name := range []string{"cloudsql databases.insert", "cloudsql users.insert", "kubernetes Create Secret", "kubernetes Create Unleash"} {
+		span, ok := spans[name]
+		if assert.True(t, ok, name) {
+			assert.Equal(t, root.SpanContext().SpanID(), span.Parent().SpanID(), name)
+			assert.Contains(t, span.Attributes(), tracing.InstanceKey.String("my-instance"), name)
+		}
+	}
+}
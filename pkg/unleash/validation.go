@@ -0,0 +1,81 @@
+package unleash
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError is a validation failure for a single config field, identified by its JSON name.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+func configFieldName(structField string) string {
+	field, ok := reflect.TypeOf(UnleashConfig{}).FieldByName(structField)
+	if !ok {
+		return structField
+	}
+
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "" || name == "-" {
+		return strings.ToLower(structField)
+	}
+
+	return name
+}
+
+// ValidationDetails maps the validation failures in err to the JSON names of the fields they concern. Failures
+// that can not be attributed to a field are keyed by "config".
+func ValidationDetails(err error) map[string]string {
+	details := map[string]string{}
+
+	add := func(field, message string) {
+		if existing, ok := details[field]; ok {
+			message = existing + "; " + message
+		}
+		details[field] = message
+	}
+
+	var walk func(err error)
+	walk = func(err error) {
+		var fieldErr *FieldError
+		var validationErrs validator.ValidationErrors
+
+		if err == nil {
+			return
+		}
+
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, err := range joined.Unwrap() {
+				walk(err)
+			}
+			return
+		}
+
+		switch {
+		case errors.As(err, &validationErrs):
+			for _, fe := range validationErrs {
+				add(configFieldName(fe.StructField()), fe.Error())
+			}
+		case errors.As(err, &fieldErr):
+			add(fieldErr.Field, fieldErr.Error())
+		default:
+			add("config", err.Error())
+		}
+	}
+	walk(err)
+
+	return details
+}